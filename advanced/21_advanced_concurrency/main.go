@@ -3,14 +3,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
+
+	"go_lang_tutorial/internal/leakcheck"
+	"go_lang_tutorial/internal/pipeline"
+	"go_lang_tutorial/internal/semaphore"
 )
 
 // ===== PATTERN 1: FAN-OUT, FAN-IN =====
 // Fan-out: Multiple goroutines reading from the same channel
 // Fan-in: Multiple goroutines writing to the same channel
+//
+// These stages only work on ints and cannot be cancelled: a consumer that
+// stops reading early leaves every upstream goroutine blocked on a send
+// forever. Pattern 6 fixes both with internal/pipeline.
 
 func producer(nums ...int) <-chan int {
 	out := make(chan int)
@@ -61,7 +72,7 @@ func merge(channels ...<-chan int) <-chan int {
 }
 
 // ===== PATTERN 2: PIPELINE =====
-func pipeline() {
+func basicPipeline() {
 	// Stage 1: Generate numbers
 	nums := producer(1, 2, 3, 4, 5)
 
@@ -75,6 +86,7 @@ func pipeline() {
 }
 
 // ===== PATTERN 3: WORKER POOL WITH RESULTS =====
+// (See workerpool.go for errors, retries, graceful shutdown and autoscaling)
 type Job struct {
 	ID   int
 	Data int
@@ -114,9 +126,15 @@ func rateLimiter() {
 }
 
 // ===== PATTERN 5: SEMAPHORE (LIMITING CONCURRENCY) =====
-func semaphore() {
+// A buffered channel also works as a semaphore (send to acquire, receive
+// to release), but it cannot give up waiting or take several slots at once.
+// internal/semaphore can; see semaphore.go for weights and timeouts, and
+// internal/semaphore's benchmarks (go test -bench . ./internal/semaphore)
+// for how it compares with the channel version.
+func limitConcurrency() {
 	const maxConcurrent = 3
-	sem := make(chan struct{}, maxConcurrent)
+	sem := semaphore.New(maxConcurrent)
+	ctx := context.Background()
 
 	var wg sync.WaitGroup
 
@@ -125,8 +143,10 @@ func semaphore() {
 		go func(id int) {
 			defer wg.Done()
 
-			sem <- struct{}{}        // Acquire
-			defer func() { <-sem }() // Release
+			if err := sem.Acquire(ctx, 1); err != nil {
+				return
+			}
+			defer sem.Release(1)
 
 			fmt.Printf("Task %d started\n", id)
 			time.Sleep(500 * time.Millisecond)
@@ -137,10 +157,112 @@ func semaphore() {
 	wg.Wait()
 }
 
+// ===== PATTERN 6: GENERIC, CANCELLABLE PIPELINES =====
+// internal/pipeline provides the stages above for any type. They all run
+// under one context: the first error cancels every stage, and Stop lets a
+// consumer quit early. Either way no goroutine is left behind.
+
+func genericPipeline() {
+	p := pipeline.New(context.Background())
+
+	nums := pipeline.Values(p, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	odd := pipeline.Filter(p, nums, func(n int) bool { return n%2 == 1 })
+
+	// Fan out to 3 workers, each formatting at its own pace, then fan in
+	var workers []<-chan string
+	for _, in := range pipeline.FanOut(p, odd, 3) {
+		workers = append(workers, pipeline.Map(p, in, func(ctx context.Context, n int) (string, error) {
+			time.Sleep(10 * time.Millisecond) // Simulated work
+			return fmt.Sprintf("%d²=%d", n, n*n), nil
+		}))
+	}
+	batches := pipeline.Batch(p, pipeline.Merge(p, workers...), 2, 50*time.Millisecond)
+
+	pipeline.Sink(p, batches, func(ctx context.Context, batch []string) error {
+		fmt.Println("Batch:", batch)
+		return nil
+	})
+	if err := p.Wait(); err != nil {
+		fmt.Println("Error:", err)
+	}
+}
+
+var errUnlucky = errors.New("unlucky number")
+
+func failingPipeline() {
+	p := pipeline.New(context.Background())
+
+	// An endless source: without cancellation this would run forever
+	counter := pipeline.Source(p, func(ctx context.Context, emit func(int) bool) error {
+		for n := 1; emit(n); n++ {
+		}
+		return nil
+	})
+	checked := pipeline.Map(p, counter, func(ctx context.Context, n int) (int, error) {
+		if n == 13 {
+			return 0, fmt.Errorf("checking %d: %w", n, errUnlucky)
+		}
+		return n, nil
+	})
+	pipeline.Sink(p, checked, func(ctx context.Context, n int) error { return nil })
+
+	// The error stops the source and every other stage
+	err := p.Wait()
+	fmt.Println("Pipeline failed:", err, "| unlucky:", errors.Is(err, errUnlucky))
+}
+
+// orderedFanOut squares numbers with 4 workers taking random time, yet
+// prints the results in input order: OrderedMap numbers the inputs and
+// holds results that finish early until their turn comes.
+func orderedFanOut() {
+	p := pipeline.New(context.Background())
+
+	nums := pipeline.Values(p, 1, 2, 3, 4, 5, 6, 7, 8)
+	squares := pipeline.OrderedMap(p, nums, 4, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(rand.Intn(50)) * time.Millisecond)
+		return n * n, nil
+	})
+
+	var ordered []int
+	pipeline.Sink(p, squares, func(ctx context.Context, n int) error {
+		ordered = append(ordered, n)
+		return nil
+	})
+	if err := p.Wait(); err != nil {
+		fmt.Println("Error:", err)
+	}
+	fmt.Println("Ordered squares:", ordered)
+}
+
+func abandonedPipelines() {
+	// The hand-written stages leak when the consumer stops early...
+	snapshot := leakcheck.Take()
+	squares := square(producer(1, 2, 3, 4, 5))
+	fmt.Println("First square:", <-squares)
+	if err := snapshot.Wait(100 * time.Millisecond); err != nil {
+		fmt.Printf("producer/square: %d goroutine(s) leaked\n", len(err.(*leakcheck.LeakError).Stacks))
+	}
+
+	// ...pipeline stages exit once the consumer calls Stop
+	snapshot = leakcheck.Take()
+	p := pipeline.New(context.Background())
+	nums := pipeline.Map(p, pipeline.Values(p, 1, 2, 3, 4, 5), func(ctx context.Context, n int) (int, error) {
+		return n * n, nil
+	})
+	fmt.Println("First square:", <-nums)
+	p.Stop()
+	p.Wait()
+	if err := snapshot.Wait(time.Second); err != nil {
+		fmt.Println("pipeline:", err)
+	} else {
+		fmt.Println("pipeline: no goroutines leaked")
+	}
+}
+
 func main() {
 	// ===== PIPELINE DEMO =====
 	fmt.Println("=== Pipeline ===")
-	pipeline()
+	basicPipeline()
 
 	// ===== FAN-OUT, FAN-IN DEMO =====
 	fmt.Println("\n=== Fan-Out, Fan-In ===")
@@ -150,7 +272,8 @@ func main() {
 	c1 := square(in)
 	c2 := square(in)
 
-	// Fan-in: Merge results
+	// Fan-in: Merge results (in whatever order the workers finish them;
+	// see orderedFanOut for a version that keeps the input order)
 	for n := range merge(c1, c2) {
 		fmt.Println(n)
 	}
@@ -183,7 +306,25 @@ func main() {
 
 	// ===== SEMAPHORE DEMO =====
 	fmt.Println("\n=== Semaphore (Max 3 concurrent) ===")
-	semaphore()
+	limitConcurrency()
+
+	fmt.Println("\n=== Weighted Semaphore ===")
+	weightedSemaphore()
+
+	// ===== GENERIC PIPELINE DEMO =====
+	fmt.Println("\n=== Generic Pipeline ===")
+	genericPipeline()
+	orderedFanOut()
+	failingPipeline()
+	abandonedPipelines()
+
+	// ===== PRODUCTION WORKER POOL DEMO =====
+	fmt.Println("\n=== Production Worker Pool ===")
+	productionWorkerPool()
+	gracefulShutdown()
+
+	fmt.Println("\n=== Autoscaling Worker Pool ===")
+	autoscalingPool()
 }
 
 // Run: go run 21_advanced_concurrency.go
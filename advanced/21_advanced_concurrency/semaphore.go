@@ -0,0 +1,59 @@
+// semaphore.go - A Weighted, Context-Aware Semaphore
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go_lang_tutorial/internal/semaphore"
+)
+
+// ===== PATTERN 9: WEIGHTED SEMAPHORE =====
+// Some work needs more of a resource than other work: a job decoding a
+// large image takes more of the memory budget than a thumbnail. With a
+// weighted semaphore each job acquires as many units as it needs. Waiters
+// are served in order, so a big job is not overtaken forever by small ones,
+// and Acquire gives up when its context ends.
+
+func weightedSemaphore() {
+	sem := semaphore.New(10) // e.g. a 10 MB budget
+	start := time.Now()
+	logf := func(format string, args ...any) {
+		fmt.Printf("  %4dms  "+format+"\n", append([]any{time.Since(start).Milliseconds()}, args...)...)
+	}
+
+	var wg sync.WaitGroup
+	job := func(name string, mb int64, delay time.Duration) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(delay) // Arrive in a known order
+			if err := sem.Acquire(context.Background(), mb); err != nil {
+				logf("%s: %v", name, err)
+				return
+			}
+			logf("%s (%d MB) started", name, mb)
+			time.Sleep(200 * time.Millisecond)
+			sem.Release(mb)
+		}()
+	}
+
+	job("A", 6, 0)
+	job("B", 8, 10*time.Millisecond) // Waits for A
+	// C would fit next to A, but queues behind B instead of starving it,
+	// and then has to wait for B as well
+	job("C", 3, 20*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	logf("TryAcquire(1) with B and C waiting: %v", sem.TryAcquire(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	logf("Acquire(1) with a 50ms timeout: %v", sem.Acquire(ctx, 1))
+	logf("Acquire(11): %v", sem.Acquire(context.Background(), 11))
+
+	wg.Wait()
+}
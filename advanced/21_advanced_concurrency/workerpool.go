@@ -0,0 +1,183 @@
+// workerpool.go - A Production Worker Pool
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go_lang_tutorial/internal/workerpool"
+)
+
+// ===== PATTERN 7: PRODUCTION WORKER POOL =====
+// The worker pool in pattern 3 has no error path, no retries and can only
+// be stopped by closing the jobs channel. internal/workerpool adds all of
+// that: Submit returns a Future, each attempt gets a timeout, failures are
+// retried with exponential backoff and jitter, a panicking job only fails
+// itself, and Shutdown drains the queue or gives up after a deadline.
+
+var errInvalidJob = errors.New("invalid job")
+
+func productionWorkerPool() {
+	pool := workerpool.New[int](workerpool.Options{
+		Workers:    3,
+		JobTimeout: 100 * time.Millisecond,
+		Retry: workerpool.RetryPolicy{
+			Attempts:  4,
+			BaseDelay: 10 * time.Millisecond,
+			MaxDelay:  100 * time.Millisecond,
+		},
+	})
+	ctx := context.Background()
+
+	var flakyCalls atomic.Int32
+	jobs := []struct {
+		name string
+		job  workerpool.Job[int]
+	}{
+		{"double", func(ctx context.Context) (int, error) {
+			return 21 * 2, nil
+		}},
+		{"flaky", func(ctx context.Context) (int, error) {
+			// Fails twice, then succeeds on the third attempt
+			if flakyCalls.Add(1) < 3 {
+				return 0, errors.New("temporary failure")
+			}
+			return 7, nil
+		}},
+		{"slow", func(ctx context.Context) (int, error) {
+			// Always exceeds JobTimeout, so every attempt times out
+			select {
+			case <-time.After(time.Second):
+				return 1, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}},
+		{"panics", func(ctx context.Context) (int, error) {
+			var m map[string]int
+			m["boom"] = 1 // Recovered into a *workerpool.PanicError
+			return 0, nil
+		}},
+		{"invalid", func(ctx context.Context) (int, error) {
+			return 0, workerpool.Permanent(errInvalidJob) // Not retried
+		}},
+	}
+
+	futures := make([]*workerpool.Future[int], len(jobs))
+	for i, j := range jobs {
+		f, err := pool.Submit(ctx, j.job)
+		if err != nil {
+			fmt.Println("Submit failed:", err)
+			return
+		}
+		futures[i] = f
+	}
+
+	for i, f := range futures {
+		v, err := f.Wait(ctx)
+		if err != nil {
+			fmt.Printf("  %-8s failed after %d attempt(s): %v\n", jobs[i].name, f.Attempts(), err)
+			continue
+		}
+		fmt.Printf("  %-8s = %d after %d attempt(s)\n", jobs[i].name, v, f.Attempts())
+	}
+
+	pool.Shutdown(ctx)
+}
+
+func gracefulShutdown() {
+	pool := workerpool.New[int](workerpool.Options{Workers: 2, QueueSize: 10})
+
+	var futures []*workerpool.Future[int]
+	for i := 1; i <= 8; i++ {
+		i := i
+		f, _ := pool.Submit(context.Background(), func(ctx context.Context) (int, error) {
+			select {
+			case <-time.After(100 * time.Millisecond):
+				return i, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		})
+		futures = append(futures, f)
+	}
+
+	// Two workers finish four 100ms jobs in 200ms. At the deadline jobs 5
+	// and 6 are cancelled mid-run, and 7 and 8 never start.
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	fmt.Println("  Shutdown:", pool.Shutdown(ctx))
+
+	for _, f := range futures {
+		v, err := f.Wait(context.Background())
+		switch {
+		case errors.Is(err, workerpool.ErrAbandoned):
+			fmt.Println("  abandoned before it started")
+		case err != nil:
+			fmt.Println("  cancelled while running:", err)
+		default:
+			fmt.Println("  finished job", v)
+		}
+	}
+
+	_, err := pool.Submit(context.Background(), func(ctx context.Context) (int, error) { return 0, nil })
+	fmt.Println("  Submit after shutdown:", err)
+}
+
+// ===== PATTERN 8: AUTOSCALING WORKER POOL =====
+// Pattern 3 always starts three workers, whether there are two jobs or two
+// thousand. With Options.Autoscale the pool starts with MinWorkers, grows
+// towards MaxWorkers while jobs queue up or wait longer than TargetWait to
+// start, and retires idle workers again once DownCooldown has passed
+// without a change. Only the wait counts: 20ms jobs stay 20ms jobs however
+// many workers run them.
+
+func autoscalingPool() {
+	start := time.Now()
+	pool := workerpool.New[int](workerpool.Options{
+		QueueSize: 50,
+		Autoscale: &workerpool.Autoscale{
+			MinWorkers:   1,
+			MaxWorkers:   8,
+			Interval:     20 * time.Millisecond,
+			TargetWait:   30 * time.Millisecond,
+			DownCooldown: 100 * time.Millisecond,
+			OnScale: func(e workerpool.ScaleEvent) {
+				fmt.Printf("  %4dms  %d -> %d workers (%s)\n",
+					e.At.Sub(start).Milliseconds(), e.From, e.To, e.Reason)
+			},
+		},
+	})
+	ctx := context.Background()
+
+	// A burst of 40 jobs of 20ms each: one worker would need 800ms
+	var futures []*workerpool.Future[int]
+	for i := 1; i <= 40; i++ {
+		i := i
+		f, err := pool.Submit(ctx, func(ctx context.Context) (int, error) {
+			time.Sleep(20 * time.Millisecond)
+			return i, nil
+		})
+		if err != nil {
+			fmt.Println("Submit failed:", err)
+			return
+		}
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		f.Wait(ctx)
+	}
+	fmt.Printf("  burst done after %dms\n", time.Since(start).Milliseconds())
+
+	// Idle again: the pool shrinks back to MinWorkers
+	time.Sleep(800 * time.Millisecond)
+
+	s := pool.Stats()
+	fmt.Printf("  workers=%d succeeded=%d scale_ups=%d scale_downs=%d avg_wait=%.1fms avg_run=%.1fms\n",
+		s.Workers, s.Succeeded, s.ScaleUps, s.ScaleDowns, s.AvgWaitMs, s.AvgRunMs)
+	pool.Shutdown(ctx)
+}
@@ -0,0 +1,208 @@
+// avatar.go - Multipart File Uploads and Content-Addressed Storage
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// ===== AVATAR UPLOADS =====
+// POST /api/users/{id}/avatar accepts a multipart form with an "avatar" file.
+// Files are stored under <static_dir>/avatars/<first 2 hex chars>/<sha256>.<ext>,
+// so identical uploads share one file and a stored file never changes. That
+// lets the static handler serve avatars with long-lived cache headers.
+
+const (
+	maxAvatarSize = 2 << 20 // 2 MB
+	avatarDir     = "avatars"
+)
+
+// staticDir is the static_dir config setting
+var staticDir = "./static"
+
+// Allowed types are decided by sniffing the content, not by trusting the
+// client's Content-Type header or file extension.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var errUnsupportedType = errors.New("unsupported image type")
+
+// avatarHandler handles /api/users/{id}/avatar (routed by userItemHandler)
+func avatarHandler(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, err := repo.Get(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	// Reject oversized bodies before parsing; leave a little room for the
+	// multipart headers around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+4096)
+	if err := r.ParseMultipartForm(maxAvatarSize); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Avatar too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		http.Error(w, "Missing avatar file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAvatarSize {
+		http.Error(w, "Avatar too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	urlPath, err := storeAvatar(file)
+	if err != nil {
+		if errors.Is(err, errUnsupportedType) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		http.Error(w, "Could not store avatar", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := repo.SetAvatar(r.Context(), id, urlPath)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	writeUser(w, http.StatusOK, user)
+}
+
+// storeAvatar writes the upload to its content-addressed location and
+// returns the URL path it is served from
+func storeAvatar(file io.Reader) (string, error) {
+	// Sniff the type from the first 512 bytes (all DetectContentType reads)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	ext, ok := avatarTypes[http.DetectContentType(head)]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errUnsupportedType, http.DetectContentType(head))
+	}
+
+	// Write to a temp file while hashing, then move it into place
+	dir := filepath.Join(staticDir, avatarDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), io.MultiReader(bytes.NewReader(head), file)); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	name := sum + ext
+	finalDir := filepath.Join(dir, sum[:2])
+	if err := os.MkdirAll(finalDir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(finalDir, name)); err != nil {
+		return "", err
+	}
+
+	return path.Join("/static", avatarDir, sum[:2], name), nil
+}
+
+// ===== STATIC FILES WITH CACHING =====
+
+// avatarPathRE matches the URLs storeAvatar hands out
+var avatarPathRE = regexp.MustCompile(`^/static/` + avatarDir + `/([0-9a-f]{2})/(([0-9a-f]{64})\.(png|jpg|gif|webp))$`)
+
+// cachingFileServer serves the static directory without directory listings.
+// Avatars are content-addressed, so their bytes never change for a given
+// URL and can be cached forever; everything else, including missing
+// avatars, must be revalidated.
+func cachingFileServer(root string) http.Handler {
+	fs := http.StripPrefix("/static/", http.FileServer(noListingFS{http.Dir(root)}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sum, ok := avatarFile(root, r.URL.Path); ok {
+			// The ETag must be set up front: FileServer compares it with
+			// If-None-Match to answer 304 Not Modified
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			w.Header().Set("ETag", `"`+sum+`"`)
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+
+		fs.ServeHTTP(w, r)
+	})
+}
+
+// avatarFile reports whether urlPath names a stored avatar, and returns
+// its hash
+func avatarFile(root, urlPath string) (sum string, ok bool) {
+	m := avatarPathRE.FindStringSubmatch(urlPath)
+	if m == nil || m[1] != m[3][:2] {
+		return "", false
+	}
+	info, err := os.Stat(filepath.Join(root, avatarDir, m[1], m[2]))
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return m[3], true
+}
+
+// noListingFS hides directories, so FileServer answers 404 instead of
+// listing every uploaded avatar
+type noListingFS struct {
+	fs http.FileSystem
+}
+
+func (n noListingFS) Open(name string) (http.File, error) {
+	f, err := n.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
@@ -0,0 +1,63 @@
+// history.go - Audit Trail and Restoring Deleted Users
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ===== HISTORY AND RESTORE =====
+// DELETE /api/users/{id} only marks the user as deleted. Every change is
+// recorded in the audit_log table together with the actor that made it
+// (see actorMiddleware), so it can be inspected and undone:
+//
+//	GET  /api/users/{id}/history           all changes, oldest first
+//	POST /api/users/{id}/restore           undelete
+//	POST /api/users/{id}/restore?entry=N   undelete and reset to history entry N
+
+// historyHandler handles /api/users/{id}/history
+func historyHandler(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := repo.History(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// restoreHandler handles /api/users/{id}/restore
+func restoreHandler(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var entryID int64
+	if s := r.URL.Query().Get("entry"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid history entry", http.StatusBadRequest)
+			return
+		}
+		entryID = n
+	}
+
+	user, err := repo.Restore(r.Context(), id, entryID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	writeUser(w, http.StatusOK, user)
+}
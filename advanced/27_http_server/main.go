@@ -3,24 +3,36 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"go_lang_tutorial/internal/config"
+	"go_lang_tutorial/internal/database"
+	"go_lang_tutorial/internal/requestid"
+	"go_lang_tutorial/internal/sqllog"
+	"go_lang_tutorial/internal/store"
+	"go_lang_tutorial/internal/store/memstore"
 )
 
 // ===== BASIC HTTP SERVER =====
 
-type User struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}
+// Users are stored in SQLite through the repository from internal/store
+// (see 29_database.go). Handlers pass r.Context() to every call, so a query
+// is cancelled as soon as the client goes away.
+type User = store.User
 
-var users = []User{
-	{ID: 1, Name: "Alice"},
-	{ID: 2, Name: "Bob"},
-}
+// repo is any store.Repository: SQLite, or memstore with -store memory
+var repo store.Repository
 
 // Handler function
 func helloHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +41,12 @@ func helloHandler(w http.ResponseWriter, r *http.Request) {
 
 // JSON response
 func usersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := repo.List(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(users)
 }
@@ -37,45 +55,265 @@ func usersHandler(w http.ResponseWriter, r *http.Request) {
 func userHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(users)
+		usersHandler(w, r)
 	case http.MethodPost:
 		var newUser User
 		if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		newUser.ID = len(users) + 1
-		users = append(users, newUser)
+		newUser.Avatar = "" // Only set through the upload endpoint
+
+		if err := repo.Create(r.Context(), &newUser); err != nil {
+			storeError(w, err)
+			return
+		}
+
+		writeUser(w, http.StatusCreated, newUser)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(newUser)
+// Routes under /api/users/{id}
+// Go 1.21's ServeMux has no path parameters, so the ID is parsed here and
+// passed on to the handler for the rest of the path.
+func userItemHandler(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "":
+		userByIDHandler(w, r, id)
+	case "avatar":
+		avatarHandler(w, r, id)
+	case "history":
+		historyHandler(w, r, id)
+	case "restore":
+		authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			restoreHandler(w, r, id)
+		})(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GET, PUT or DELETE /api/users/{id}
+// Deleting requires authorization and can be undone (see history.go).
+func userByIDHandler(w http.ResponseWriter, r *http.Request, id int64) {
+	switch r.Method {
+	case http.MethodGet:
+		user, err := repo.Get(r.Context(), id)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == userETag(user) {
+			w.Header().Set("ETag", userETag(user))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeUser(w, http.StatusOK, user)
+	case http.MethodPut:
+		updateUser(w, r, id)
+	case http.MethodDelete:
+		authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			if err := repo.Delete(r.Context(), id); err != nil {
+				storeError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// ===== OPTIMISTIC CONCURRENCY =====
+// Every user has a version that changes on each write and is sent as the
+// ETag. A PUT must send it back in If-Match; if someone else changed the
+// user in the meantime the versions differ and the update is rejected with
+// 412 Precondition Failed instead of silently overwriting their change.
+
+func userETag(u User) string {
+	return `"` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// writeUser sends u as JSON along with its ETag
+func writeUser(w http.ResponseWriter, status int, u User) {
+	w.Header().Set("ETag", userETag(u))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(u)
+}
+
+// PUT /api/users/{id} with If-Match: "<version>" (or * for any version)
+func updateUser(w http.ResponseWriter, r *http.Request, id int64) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header required", http.StatusPreconditionRequired)
+		return
+	}
+
+	var user User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current, err := repo.Get(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	user.ID = id
+	user.Avatar = current.Avatar // Only set through the upload endpoint
+	if ifMatch == "*" {
+		user.Version = current.Version
+	} else {
+		v, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+		if err != nil {
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+			return
+		}
+		user.Version = v
+	}
+
+	if err := repo.Update(r.Context(), &user); err != nil {
+		storeError(w, err)
+		return
+	}
+	writeUser(w, http.StatusOK, user)
+}
+
+// GET /api/users/search?q=ali&limit=10
+// Full-text search over names and emails (needs -tags sqlite_fts5)
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Missing query parameter q", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	results, err := repo.Search(r.Context(), q, limit)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if results == nil {
+		results = []store.SearchResult{} // Encode as [] rather than null
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// storeError maps repository errors to HTTP status codes
+func storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrInvalidUser):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrDuplicateEmail):
+		http.Error(w, "Email already in use", http.StatusConflict)
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "Precondition Failed: user was modified", http.StatusPreconditionFailed)
+	case errors.Is(err, store.ErrSearchUnavailable):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Database timeout", http.StatusServiceUnavailable)
+	case errors.Is(err, context.Canceled):
+		// Client went away; nobody is left to read a response
+	default:
+		log.Printf("store error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// seedUsers adds the example users to an empty database
+func seedUsers(ctx context.Context) error {
+	existing, err := repo.List(ctx)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	for _, u := range []User{
+		{Name: "Alice", Email: "alice@example.com", Age: 30},
+		{Name: "Bob", Email: "bob@example.com", Age: 25},
+	} {
+		if err := repo.Create(ctx, &u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ===== MIDDLEWARE =====
 
+// Actor middleware
+// Records who is making the request so the repository can attribute
+// changes to them in the audit log: "admin" for requests carrying the auth
+// token, "anonymous" otherwise, plus the client address.
+func actorMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor := "anonymous"
+		if r.Header.Get("Authorization") == authToken {
+			actor = "admin"
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			actor += "@" + host
+		}
+
+		next(w, r.WithContext(store.WithActor(r.Context(), actor)))
+	}
+}
+
 // Logging middleware
+// Lines carry the request ID (see requestid.Middleware in main), like the
+// SQL statements the request runs, so they can be matched up in the log.
 func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("Started %s %s", r.Method, r.URL.Path)
+		id := requestid.FromContext(r.Context())
+		log.Printf("[req %s] Started %s %s", id, r.Method, r.URL.Path)
 
 		next(w, r)
 
-		log.Printf("Completed in %v", time.Since(start))
+		log.Printf("[req %s] Completed in %v", id, time.Since(start))
 	}
 }
 
 // Auth middleware (simple example)
+// The expected token comes from the auth_token config setting.
+var authToken string
+
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Authorization")
 
-		if token != "secret-token" {
+		if token != authToken {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -84,7 +322,85 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// Settings used when no config file, environment variable or flag sets
+// them (see internal/config)
+var defaultOptions = config.ServerOptions{
+	Port:         8080,
+	ReadTimeout:  10 * time.Second,
+	WriteTimeout: 10 * time.Second,
+	IdleTimeout:  60 * time.Second,
+	AuthToken:    "secret-token",
+	StaticDir:    "./static",
+	Database:     ":memory:",
+	QueryTimeout: 5 * time.Second,
+
+	DBMaxOpenConns:    25,
+	DBMaxIdleConns:    5,
+	DBConnMaxLifetime: 5 * time.Minute,
+	DBConnMaxIdleTime: time.Minute,
+
+	SlowQuery: 200 * time.Millisecond,
+}
+
 func main() {
+	// ===== CONFIGURATION =====
+	// defaultOptions can be overridden by a config file (-config or
+	// APP_CONFIG), environment variables (APP_PORT, APP_AUTH_TOKEN, ...)
+	// and flags (-port, -auth-token, ...). See internal/config.
+	opts, err := config.Load(defaultOptions, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	authToken = opts.AuthToken
+	staticDir = opts.StaticDir
+
+	// ===== STORAGE =====
+	// Handlers only use the store.Repository interface, so the backend is
+	// a config choice. The in-memory store needs no database at all.
+	ctx := context.Background()
+	var db *sql.DB
+	if opts.Store == "memory" {
+		repo = memstore.New()
+	} else {
+		// Query log: statements slower than -slow-query are always logged,
+		// -log-queries logs all of them. Each line carries the request ID.
+		var dbOpts []database.Option
+		if opts.LogQueries || opts.SlowQuery > 0 {
+			dbOpts = append(dbOpts, database.WithQueryLog(sqllog.Options{
+				SlowThreshold: opts.SlowQuery,
+				SlowOnly:      !opts.LogQueries,
+			}))
+		}
+
+		db, err = database.OpenMigrated(ctx, opts.Database, database.PoolOptions{
+			MaxOpenConns:    opts.DBMaxOpenConns,
+			MaxIdleConns:    opts.DBMaxIdleConns,
+			ConnMaxLifetime: opts.DBConnMaxLifetime,
+			ConnMaxIdleTime: opts.DBConnMaxIdleTime,
+		}, dbOpts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		// Pool statistics: /debug/vars (expvar "db") and /debug/db, plus a log
+		// warning whenever queries had to wait for a free connection
+		database.PublishStats("db", db)
+		go database.WatchPool(ctx, db, time.Minute)
+
+		// Online snapshots with rotation, e.g.
+		//   -backup-dir backups -backup-interval 1h -backup-keep 24
+		// Restore one with: go run 29_database.go restore -db app.db FILE
+		if opts.BackupInterval > 0 {
+			go database.ScheduleSnapshots(ctx, db, opts.BackupDir, opts.BackupInterval, opts.BackupKeep)
+		}
+
+		repo = store.NewUserRepository(db, store.WithQueryTimeout(opts.QueryTimeout))
+	}
+	if err := seedUsers(ctx); err != nil {
+		log.Fatal(err)
+	}
+
 	// ===== SIMPLE SERVER =====
 	// http.HandleFunc("/", helloHandler)
 	// log.Fatal(http.ListenAndServe(":8080", nil))
@@ -94,30 +410,49 @@ func main() {
 	// Basic routes
 	http.HandleFunc("/", helloHandler)
 	http.HandleFunc("/users", loggingMiddleware(usersHandler))
-	http.HandleFunc("/api/users", loggingMiddleware(userHandler))
+	http.HandleFunc("/api/users", loggingMiddleware(actorMiddleware(userHandler)))
+	http.HandleFunc("/api/users/", loggingMiddleware(actorMiddleware(userItemHandler)))
+	http.HandleFunc("/api/users/search", loggingMiddleware(searchHandler))
 
 	// Protected route
 	http.HandleFunc("/protected", loggingMiddleware(authMiddleware(protectedHandler)))
 
-	// Static file server
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	// Debug endpoint with connection pool statistics
+	if db != nil {
+		http.HandleFunc("/debug/db", authMiddleware(database.StatsHandler(db)))
+	}
+
+	// Static file server (with cache headers, see avatar.go)
+	http.Handle("/static/", cachingFileServer(staticDir))
 
 	// ===== CUSTOM SERVER =====
+	// Every request gets an X-Request-ID before routing, so all handlers,
+	// middleware and SQL statements can log it.
 	server := &http.Server{
-		Addr:         ":8080",
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:         opts.Addr(),
+		Handler:      requestid.Middleware(http.DefaultServeMux.ServeHTTP),
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		IdleTimeout:  opts.IdleTimeout,
 	}
 
-	fmt.Println("Server starting on :8080")
+	fmt.Println("Server starting on", server.Addr)
 	fmt.Println("Routes:")
 	fmt.Println("  GET  /")
 	fmt.Println("  GET  /users")
 	fmt.Println("  GET  /api/users")
 	fmt.Println("  POST /api/users")
-	fmt.Println("  GET  /protected (requires Authorization: secret-token)")
+	fmt.Println("  GET  /api/users/search?q=... (full-text, needs -tags sqlite_fts5)")
+	fmt.Println("  GET  /api/users/{id} (ETag)")
+	fmt.Println("  PUT  /api/users/{id} (requires If-Match)")
+	fmt.Println("  DELETE /api/users/{id} (soft delete, requires Authorization)")
+	fmt.Println("  GET  /api/users/{id}/history")
+	fmt.Println("  POST /api/users/{id}/restore[?entry=N] (requires Authorization)")
+	fmt.Println("  POST /api/users/{id}/avatar (multipart, field \"avatar\")")
+	fmt.Println("  GET  /static/...")
+	fmt.Println("  GET  /debug/db (pool statistics, requires Authorization)")
+	fmt.Println("  GET  /debug/vars (expvar metrics)")
+	fmt.Println("  GET  /protected (requires Authorization: " + authToken + ")")
 
 	log.Fatal(server.ListenAndServe())
 }
@@ -143,7 +478,27 @@ func protectedHandler(w http.ResponseWriter, r *http.Request) {
    # POST new user
    curl -X POST http://localhost:8080/api/users \
      -H "Content-Type: application/json" \
-     -d '{"name":"Charlie"}'
+     -d '{"name":"Charlie","email":"charlie@example.com","age":40}'
+
+   # Search names and emails (run with: go run -tags sqlite_fts5 .)
+   curl "http://localhost:8080/api/users/search?q=ali"
+
+   # Update a user: send back the ETag from GET, or get 412 if it changed
+   curl -i http://localhost:8080/api/users/1
+   curl -X PUT http://localhost:8080/api/users/1 -H 'If-Match: "1"' \
+     -d '{"name":"Alice","email":"alice@example.com","age":31}'
+
+   # Delete a user, look at its history and bring it back
+   curl -X DELETE http://localhost:8080/api/users/2 -H "Authorization: secret-token"
+   curl http://localhost:8080/api/users/2/history
+   curl -X POST http://localhost:8080/api/users/2/restore -H "Authorization: secret-token"
+
+   # Upload an avatar (PNG, JPEG, GIF or WebP, max 2 MB)
+   curl -X POST http://localhost:8080/api/users/1/avatar \
+     -F "avatar=@me.png"
+
+   # Fetch it back (path from the "avatar" field of the response)
+   curl -i http://localhost:8080/static/avatars/ab/ab12...ef.png
 
    # Protected route (unauthorized)
    curl http://localhost:8080/protected
@@ -152,6 +507,20 @@ func protectedHandler(w http.ResponseWriter, r *http.Request) {
    curl http://localhost:8080/protected \
      -H "Authorization: secret-token"
 
+   # Pass your own request ID to find the request's lines in the log
+   # (otherwise one is generated and returned in X-Request-ID)
+   curl -i http://localhost:8080/api/users/1 -H "X-Request-ID: debug-42"
+
+3. Configure it (flags > env > config file > defaults):
+
+   go run 27_http_server.go -port 9090 -auth-token s3cret
+   APP_PORT=9090 APP_READ_TIMEOUT=5s go run 27_http_server.go
+   go run 27_http_server.go -config server.example.yaml  # every file setting
+
+   # Serve generated users, e.g. for load testing
+   go run 29_database.go seed -db app.db -count 10000
+   go run 27_http_server.go -database app.db
+
 ===== POPULAR FRAMEWORKS =====
 
 While net/http is powerful, you might want to use frameworks for larger apps:
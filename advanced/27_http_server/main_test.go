@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/config"
+)
+
+// The example config file documented in main.go loads, comments and all
+func TestExampleConfig(t *testing.T) {
+	opts, err := config.Load(defaultOptions, []string{"-config", "server.example.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := defaultOptions
+	want.Port = 9090
+	want.WriteTimeout = 15 * time.Second
+	want.AuthToken = "s3cret"
+	want.Store = "sqlite"
+	want.Database = "app.db"
+	want.QueryTimeout = 2 * time.Second
+	want.DBMaxOpenConns = 10
+	want.DBConnMaxLifetime = 10 * time.Minute
+	want.BackupDir = "backups"
+	want.BackupInterval = time.Hour
+	want.BackupKeep = 24
+	want.LogQueries = true
+	want.SlowQuery = 100 * time.Millisecond
+	if opts != want {
+		t.Errorf("Load(-config server.example.yaml) =\n%+v\nwant\n%+v", opts, want)
+	}
+}
@@ -0,0 +1,348 @@
+// gateway.go - Reverse Proxy / API Gateway built from the middleware above
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go_lang_tutorial/internal/config"
+	"go_lang_tutorial/internal/requestid"
+)
+
+// ===== GATEWAY CONFIGURATION =====
+// The gateway is driven by a JSON file (see gateway.example.json):
+//
+//	{
+//	  "listen": ":8000",
+//	  "health_interval": "5s",
+//	  "routes": [
+//	    {
+//	      "prefix": "/users/",
+//	      "rewrite": "/api/users",
+//	      "upstreams": ["http://localhost:8080", "http://localhost:8081"],
+//	      "health_path": "/",
+//	      "middleware": ["requestid", "logging", "recovery", "cors", "auth", "ratelimit"],
+//	      "rate_limit": 10
+//	    }
+//	  ]
+//	}
+
+type GatewayConfig struct {
+	Listen         string        `json:"listen"`
+	HealthInterval Duration      `json:"health_interval"`
+	Routes         []RouteConfig `json:"routes"`
+}
+
+type RouteConfig struct {
+	Prefix     string   `json:"prefix"`      // Incoming path prefix, e.g. "/users/"
+	Rewrite    string   `json:"rewrite"`     // Replaces Prefix before proxying ("" strips it)
+	Upstreams  []string `json:"upstreams"`   // Base URLs, balanced round-robin
+	HealthPath string   `json:"health_path"` // Probed on every upstream; "" disables checks
+	Middleware []string `json:"middleware"`  // Applied in order, outermost first
+	RateLimit  int      `json:"rate_limit"`  // Requests per second for "ratelimit"
+}
+
+// Duration lets durations be written as "5s" or "250ms" in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func LoadGatewayConfig(filename string) (*GatewayConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("load gateway config: %w", err)
+	}
+
+	cfg := &GatewayConfig{
+		Listen:         ":8000",
+		HealthInterval: Duration(5 * time.Second),
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse gateway config: %w", err)
+	}
+
+	if len(cfg.Routes) == 0 {
+		return nil, fmt.Errorf("gateway config: no routes defined")
+	}
+	for i, rt := range cfg.Routes {
+		if !strings.HasPrefix(rt.Prefix, "/") {
+			return nil, fmt.Errorf("gateway config: route %d: prefix %q must start with /", i, rt.Prefix)
+		}
+		if len(rt.Upstreams) == 0 {
+			return nil, fmt.Errorf("gateway config: route %q: no upstreams", rt.Prefix)
+		}
+		for _, name := range rt.Middleware {
+			if _, ok := middlewareRegistry[name]; !ok {
+				return nil, fmt.Errorf("gateway config: route %q: unknown middleware %q", rt.Prefix, name)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// ===== PER-ROUTE MIDDLEWARE STACKS =====
+// Each name in a route's "middleware" list maps to one of the middleware
+// defined in main.go. Factories receive the route so that parameterised
+// middleware (like the rate limiter) get one instance per route.
+
+var middlewareRegistry = map[string]func(RouteConfig) Middleware{
+	"logging":  func(RouteConfig) Middleware { return LoggingMiddleware },
+	"recovery": func(RouteConfig) Middleware { return RecoveryMiddleware },
+	"cors":     func(RouteConfig) Middleware { return CORSMiddleware },
+	"auth":     func(RouteConfig) Middleware { return AuthMiddleware },
+	"ratelimit": func(rt RouteConfig) Middleware {
+		rps := rt.RateLimit
+		if rps <= 0 {
+			rps = 1
+		}
+		return RateLimitMiddleware(rps)
+	},
+	// Sets X-Request-ID on the proxied request, so the upstream logs the
+	// same ID (27_http_server.go reuses it for its access and SQL logs)
+	"requestid": func(RouteConfig) Middleware { return requestid.Middleware },
+}
+
+func buildMiddleware(rt RouteConfig) []Middleware {
+	middlewares := make([]Middleware, 0, len(rt.Middleware))
+	for _, name := range rt.Middleware {
+		middlewares = append(middlewares, middlewareRegistry[name](rt))
+	}
+	return middlewares
+}
+
+// ===== UPSTREAMS AND ROUND-ROBIN BALANCING =====
+
+type upstream struct {
+	target  *url.URL
+	proxy   *httputil.ReverseProxy
+	healthy atomic.Bool
+}
+
+type upstreamPool struct {
+	upstreams []*upstream
+	next      atomic.Uint64
+}
+
+// pick returns the next healthy upstream, or nil if all are down
+func (p *upstreamPool) pick() *upstream {
+	n := uint64(len(p.upstreams))
+	start := p.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		u := p.upstreams[(start+i)%n]
+		if u.healthy.Load() {
+			return u
+		}
+	}
+	return nil
+}
+
+// rewritePath swaps the route prefix for its rewrite target
+func rewritePath(path, prefix, rewrite string) string {
+	rest := strings.TrimPrefix(path, prefix)
+	if rest == "" && rewrite != "" {
+		return rewrite
+	}
+	return strings.TrimSuffix(rewrite, "/") + "/" + strings.TrimPrefix(rest, "/")
+}
+
+func newUpstreamPool(rt RouteConfig) (*upstreamPool, error) {
+	pool := &upstreamPool{}
+	checked := rt.HealthPath != ""
+
+	for _, raw := range rt.Upstreams {
+		target, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: upstream %q: %w", rt.Prefix, raw, err)
+		}
+
+		u := &upstream{target: target}
+		u.healthy.Store(true) // Optimistic until the first health check
+		u.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.URL.Path = rewritePath(pr.In.URL.Path, rt.Prefix, rt.Rewrite)
+				pr.Out.URL.RawPath = ""
+				pr.SetURL(u.target)
+				pr.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				// A client that went away says nothing about the upstream
+				if !errors.Is(err, context.Canceled) {
+					log.Printf("gateway: upstream %s failed: %v", u.target, err)
+					// Only the health checker can bring an upstream back, so
+					// without one a single failure must not take it out
+					if checked {
+						u.healthy.Store(false)
+					}
+				}
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			},
+		}
+		pool.upstreams = append(pool.upstreams, u)
+	}
+
+	return pool, nil
+}
+
+// ===== HEALTH CHECKS =====
+
+// healthCheck probes every upstream each interval until ctx is done
+func (p *upstreamPool) healthCheck(ctx context.Context, client *http.Client, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, u := range p.upstreams {
+			ok := probe(ctx, client, u.target.JoinPath(path).String())
+			if ctx.Err() != nil {
+				return // A probe cut short says nothing about the upstream
+			}
+			if was := u.healthy.Swap(ok); was != ok {
+				log.Printf("gateway: upstream %s healthy=%v", u.target, ok)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func probe(ctx context.Context, client *http.Client, rawURL string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+// ===== GATEWAY HANDLER =====
+
+// NewGateway builds the gateway's handler. Health checks run in the
+// background until ctx is done.
+func NewGateway(ctx context.Context, cfg *GatewayConfig) (http.Handler, error) {
+	mux := http.NewServeMux()
+	client := &http.Client{Timeout: 2 * time.Second}
+	context.AfterFunc(ctx, client.CloseIdleConnections)
+
+	// Register longer prefixes first so the printed route table reads naturally;
+	// ServeMux already prefers the longest matching pattern.
+	routes := append([]RouteConfig(nil), cfg.Routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].Prefix) > len(routes[j].Prefix)
+	})
+
+	for _, rt := range routes {
+		pool, err := newUpstreamPool(rt)
+		if err != nil {
+			return nil, err
+		}
+
+		if rt.HealthPath != "" {
+			go pool.healthCheck(ctx, client, rt.HealthPath, time.Duration(cfg.HealthInterval))
+		}
+
+		proxy := func(w http.ResponseWriter, r *http.Request) {
+			u := pool.pick()
+			if u == nil {
+				http.Error(w, "No healthy upstream", http.StatusServiceUnavailable)
+				return
+			}
+			u.proxy.ServeHTTP(w, r)
+		}
+
+		mux.HandleFunc(rt.Prefix, Chain(proxy, buildMiddleware(rt)...))
+		fmt.Printf("  %-20s -> %s %v\n", rt.Prefix, strings.Join(rt.Upstreams, ", "), rt.Middleware)
+	}
+
+	return mux, nil
+}
+
+func runGateway(args []string) {
+	// Route flags sit next to the shared server settings, so -auth-token,
+	// APP_AUTH_TOKEN etc. also configure the gateway's auth middleware.
+	fs := flag.NewFlagSet("gateway", flag.ExitOnError)
+	routesPath := fs.String("routes", "gateway.json", "path to the gateway route configuration")
+
+	opts, err := config.LoadFlagSet(fs, defaultOptions, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authToken = opts.AuthToken
+
+	cfg, err := LoadGatewayConfig(*routesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Ctrl+C stops the health checks and lets in-flight requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Gateway starting on %s\n", cfg.Listen)
+	fmt.Println("\nRoutes:")
+	handler, err := NewGateway(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &http.Server{Addr: cfg.Listen, Handler: handler}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/*
+===== TRYING THE GATEWAY =====
+
+# Start the HTTP server lesson as an upstream (listens on :8080)
+go run ./advanced/27_http_server
+
+# Start the gateway in front of them
+go run ./advanced/28_middleware_patterns gateway -routes advanced/28_middleware_patterns/gateway.example.json
+
+# Proxied, with the route's middleware stack applied
+curl http://localhost:8000/users/ -H "Authorization: Bearer valid-token"
+*/
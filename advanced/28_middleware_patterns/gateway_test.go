@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/leakcheck"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestGatewayHealthChecks(t *testing.T) {
+	leakcheck.Check(t)
+
+	var down atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := NewGateway(ctx, &GatewayConfig{
+		HealthInterval: Duration(10 * time.Millisecond),
+		Routes: []RouteConfig{{
+			Prefix:     "/users/",
+			Rewrite:    "/api/users",
+			Upstreams:  []string{upstream.URL},
+			HealthPath: "/health",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := httptest.NewServer(handler)
+	defer gateway.Close()
+
+	if code, body := get(t, gateway.URL+"/users/42"); code != http.StatusOK || body != "/api/users/42" {
+		t.Fatalf("GET /users/42 = %d %q, want 200 from /api/users/42", code, body)
+	}
+
+	// A failing health check takes the only upstream out of rotation
+	down.Store(true)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if code, _ := get(t, gateway.URL+"/users/42"); code == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("upstream still in rotation after failing its health checks")
+		}
+	}
+
+	// Cancelling ctx stops the health checker; leakcheck fails the test
+	// if it keeps running
+	cancel()
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
+
+	"go_lang_tutorial/internal/config"
 )
 
 // ===== MIDDLEWARE PATTERN =====
@@ -76,6 +79,10 @@ func RateLimitMiddleware(requestsPerSecond int) Middleware {
 }
 
 // 5. Authentication Middleware
+// authToken is the full Authorization header value to accept; it comes from
+// the auth_token config setting.
+var authToken string
+
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Authorization")
@@ -86,7 +93,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// Validate token (simplified)
-		if token != "Bearer valid-token" {
+		if token != authToken {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
@@ -119,7 +126,30 @@ func panicHandler(w http.ResponseWriter, r *http.Request) {
 	panic("Something went wrong!")
 }
 
+// Defaults for the auth_token, port and timeout settings (see internal/config)
+var defaultOptions = config.ServerOptions{
+	Port:         8080,
+	ReadTimeout:  10 * time.Second,
+	WriteTimeout: 10 * time.Second,
+	IdleTimeout:  60 * time.Second,
+	AuthToken:    "Bearer valid-token",
+}
+
 func main() {
+	// ===== GATEWAY MODE =====
+	// go run ./advanced/28_middleware_patterns gateway -routes gateway.json
+	// (see gateway.go)
+	if len(os.Args) > 1 && os.Args[1] == "gateway" {
+		runGateway(os.Args[2:])
+		return
+	}
+
+	opts, err := config.Load(defaultOptions, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	authToken = opts.AuthToken
+
 	// ===== USING MIDDLEWARE =====
 
 	// Single middleware
@@ -160,7 +190,7 @@ func main() {
 		),
 	)
 
-	fmt.Println("Server starting on :8080")
+	fmt.Println("Server starting on", opts.Addr())
 	fmt.Println("\nEndpoints:")
 	fmt.Println("  GET  /           - Home (with logging)")
 	fmt.Println("  GET  /api        - API (with logging, recovery, CORS)")
@@ -169,9 +199,15 @@ func main() {
 	fmt.Println("  GET  /limited    - Rate limited (2 req/sec)")
 
 	fmt.Println("\nTest protected endpoint:")
-	fmt.Println("  curl http://localhost:8080/protected -H 'Authorization: Bearer valid-token'")
+	fmt.Printf("  curl http://localhost%s/protected -H 'Authorization: %s'\n", opts.Addr(), authToken)
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{
+		Addr:         opts.Addr(),
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		IdleTimeout:  opts.IdleTimeout,
+	}
+	log.Fatal(server.ListenAndServe())
 }
 
 /*
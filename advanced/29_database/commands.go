@@ -0,0 +1,358 @@
+// commands.go - Command-line tools for a file-backed database
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_lang_tutorial/internal/database"
+	"go_lang_tutorial/internal/fakedata"
+	"go_lang_tutorial/internal/migrate"
+	"go_lang_tutorial/internal/store"
+	"go_lang_tutorial/internal/userio"
+)
+
+// ===== COMMANDS =====
+// With arguments, this lesson acts as a small admin tool for an SQLite file:
+//
+//	go run 29_database.go migrate up     -db app.db
+//	go run 29_database.go migrate down 1 -db app.db
+//	go run 29_database.go migrate status -db app.db
+//	go run 29_database.go import -db app.db users.csv
+//	go run 29_database.go export -db app.db -format jsonl > users.jsonl
+//	go run 29_database.go seed -db app.db -count 10000 -seed 42
+//	go run 29_database.go backup -db app.db snapshot.db
+//	go run 29_database.go backup -db app.db -dir backups -keep 24 -every 1h
+//	go run 29_database.go restore -db app.db snapshot.db
+//	go run 29_database.go queue work -db app.db -workers 4
+
+var commands = map[string]func(args []string) error{
+	"migrate": migrateCommand,
+	"import":  importCommand,
+	"export":  exportCommand,
+	"seed":    seedCommand,
+	"backup":  backupCommand,
+	"restore": restoreCommand,
+	"queue":   queueCommand, // see taskqueue.go
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd(args)
+}
+
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [N]|status -db FILE")
+	}
+	action, args := args[0], args[1:]
+
+	steps := 1
+	if action == "down" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("migrate down: invalid step count %q", args[0])
+		}
+		steps, args = n, args[1:]
+	}
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	db, err := database.Open(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied  %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+		return err
+	case "down":
+		reverted, err := m.Down(ctx, steps)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+				if !s.ChecksumOK {
+					state += " (CHECKSUM MISMATCH)"
+				}
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q\n", action)
+		return fmt.Errorf("usage: migrate up|down [N]|status -db FILE")
+	}
+}
+
+// importCommand loads users from a CSV or JSON Lines file (or stdin) in a
+// single transaction, reporting rows that were rejected
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file")
+	format := fs.String("format", "", "csv or jsonl (default: from the file extension)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-db FILE] [-format csv|jsonl] FILE|-")
+	}
+
+	in, name, err := openInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	f, err := pickFormat(*format, name)
+	if err != nil {
+		return err
+	}
+	users, err := userio.Read(in, f)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := database.OpenMigrated(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := store.NewUserRepository(db).BulkCreate(ctx, users)
+	if err != nil {
+		return err
+	}
+
+	for _, rowErr := range result.Errors {
+		fmt.Fprintf(os.Stderr, "record %d (%s): %v\n", rowErr.Row+1, rowErr.User.Email, rowErr.Err)
+	}
+	fmt.Printf("imported %d of %d users\n", result.Inserted, len(users))
+	return nil
+}
+
+// exportCommand writes all users as CSV or JSON Lines to a file or stdout
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file")
+	format := fs.String("format", "", "csv or jsonl (default: from the file extension, csv for stdout)")
+	fs.Parse(args)
+
+	target := "-"
+	if fs.NArg() > 0 {
+		target = fs.Arg(0)
+	}
+	name := target
+	if target == "-" && *format == "" {
+		name = "stdout.csv"
+	}
+	f, err := pickFormat(*format, name)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := database.OpenMigrated(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	users, err := store.NewUserRepository(db).List(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if target != "-" {
+		if out, err = os.Create(target); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	if err := userio.Write(out, f, users); err != nil {
+		return err
+	}
+	if target != "-" {
+		fmt.Printf("exported %d users to %s\n", len(users), target)
+		return out.Close()
+	}
+	return nil
+}
+
+// seedCommand fills the database with generated users, e.g. to load test
+// the HTTP API (go run 27_http_server.go -database app.db). The same -seed
+// always produces the same users. Rows go in batches of one transaction
+// each, so Ctrl+C stops after the current batch and keeps what was written.
+func seedCommand(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file")
+	count := fs.Int("count", 1000, "number of users to generate")
+	seed := fs.Int64("seed", 1, "random seed; the same seed gives the same users")
+	batch := fs.Int("batch", 1000, "users inserted per transaction")
+	minAge := fs.Int("min-age", 18, "youngest generated age")
+	maxAge := fs.Int("max-age", 80, "oldest generated age")
+	fs.Parse(args)
+
+	if fs.NArg() != 0 || *count < 1 || *batch < 1 || *minAge < 0 || *maxAge < *minAge {
+		return fmt.Errorf("usage: seed [-db FILE] [-count N] [-seed S] [-batch N] [-min-age A] [-max-age A]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := database.OpenMigrated(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := store.NewUserRepository(db)
+	gen := fakedata.New(*seed, fakedata.WithAgeRange(*minAge, *maxAge))
+
+	start := time.Now()
+	inserted, skipped := 0, 0
+	for done := 0; done < *count && ctx.Err() == nil; {
+		n := min(*batch, *count-done)
+		result, err := repo.BulkCreate(ctx, gen.Users(n))
+		if err != nil {
+			return err
+		}
+		done += n
+		inserted += result.Inserted
+		skipped += len(result.Errors)
+		fmt.Printf("\r%d/%d users", done, *count)
+	}
+	fmt.Println()
+
+	elapsed := time.Since(start)
+	fmt.Printf("inserted %d users in %v (%.0f/s)\n", inserted, elapsed.Round(time.Millisecond),
+		float64(inserted)/elapsed.Seconds())
+	if skipped > 0 {
+		// Seeding twice with the same -seed generates the same emails
+		fmt.Printf("skipped %d users whose email was already taken\n", skipped)
+	}
+	return ctx.Err()
+}
+
+// backupCommand snapshots the database to a file, or into a directory of
+// rotated snapshots, optionally repeating until interrupted. It is safe to
+// run while a server is using the database.
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file")
+	dir := fs.String("dir", "backups", "directory for timestamped snapshots (when no FILE is given)")
+	keep := fs.Int("keep", 7, "number of snapshots to keep in -dir (0 keeps all)")
+	every := fs.Duration("every", 0, "take a snapshot at this interval until interrupted")
+	fs.Parse(args)
+
+	if fs.NArg() > 1 || (fs.NArg() == 1 && *every > 0) {
+		return fmt.Errorf("usage: backup [-db FILE] FILE | backup [-db FILE] [-dir DIR] [-keep N] [-every D]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := database.Open(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if fs.NArg() == 1 {
+		if err := database.Snapshot(ctx, db, fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Printf("wrote snapshot %s\n", fs.Arg(0))
+		return nil
+	}
+
+	path, err := database.SnapshotDir(ctx, db, *dir, *keep)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote snapshot %s\n", path)
+
+	if *every > 0 {
+		fmt.Printf("taking a snapshot every %v, press Ctrl+C to stop\n", *every)
+		database.ScheduleSnapshots(ctx, db, *dir, *every, *keep)
+	}
+	return nil
+}
+
+// restoreCommand replaces the database contents with a snapshot after
+// checking the snapshot's integrity
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file to overwrite")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: restore [-db FILE] SNAPSHOT")
+	}
+
+	ctx := context.Background()
+	db, err := database.Open(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := database.Restore(ctx, db, fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s from %s (integrity check ok)\n", *dbPath, fs.Arg(0))
+	return nil
+}
+
+func openInput(path string) (io.ReadCloser, string, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), "", nil
+	}
+	f, err := os.Open(path)
+	return f, path, err
+}
+
+func pickFormat(flagValue, filename string) (userio.Format, error) {
+	if flagValue != "" {
+		return userio.Format(flagValue), nil
+	}
+	return userio.FormatOf(filename)
+}
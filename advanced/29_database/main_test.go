@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/dbtest"
+)
+
+func TestLongQueryCancelled(t *testing.T) {
+	db := dbtest.New(t)
+
+	start := time.Now()
+	err := longQuery(context.Background(), db, 50*time.Millisecond)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("longQuery() error = %v, want context.DeadlineExceeded", err)
+	}
+	// Counting to a billion takes far longer; returning soon after the
+	// deadline shows SQLite was interrupted rather than waited for
+	if elapsed > time.Second {
+		t.Errorf("longQuery() returned after %v, want shortly after the 50ms deadline", elapsed)
+	}
+}
+
+func TestLongQueryParentCancelled(t *testing.T) {
+	db := dbtest.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := longQuery(ctx, db, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("longQuery() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("longQuery() returned after %v, want shortly after cancel", elapsed)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go_lang_tutorial/internal/dbtest"
+	"go_lang_tutorial/internal/store"
+)
+
+// Repository tests usually start from known rows rather than building them
+// through the code under test. dbtest gives each test its own migrated
+// :memory: database and loads the fixture files into it.
+
+func TestFixtures(t *testing.T) {
+	repo := dbtest.NewRepository(t, "testdata/users.yaml", "testdata/audit_log.json")
+	ctx := context.Background()
+
+	users, err := repo.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("List: got %d users, want 3 (Dave is deleted)", len(users))
+	}
+
+	carol, err := repo.Get(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carol.Name != "Carol O'Brien" || carol.Version != 4 {
+		t.Errorf("Get(3) = %+v, want Carol O'Brien at version 4", carol)
+	}
+
+	history, err := repo.History(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Action != store.ActionCreate {
+		t.Fatalf("History(4) = %+v, want create, update, delete", history)
+	}
+
+	restored, err := repo.Restore(ctx, 4, history[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Age != 40 {
+		t.Errorf("Restore to entry %d: age %d, want 40", history[0].ID, restored.Age)
+	}
+}
+
+func TestGetDeleted(t *testing.T) {
+	repo := dbtest.NewRepository(t, "testdata/users.yaml")
+
+	if _, err := repo.Get(context.Background(), 4); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get(4) error = %v, want ErrNotFound for a soft-deleted user", err)
+	}
+}
+
+func TestFindByEmail(t *testing.T) {
+	repo := dbtest.NewRepository(t, "testdata/users.yaml")
+
+	bob, err := repo.FindByEmail(context.Background(), "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.ID != 2 || bob.Avatar != "avatars/bo/bob.png" {
+		t.Errorf("FindByEmail(bob) = %+v, want user 2 with an avatar", bob)
+	}
+}
+
+func TestCreateDuplicateEmail(t *testing.T) {
+	repo := dbtest.NewRepository(t, "testdata/users.yaml")
+
+	u := store.User{Name: "Alice Again", Email: "alice@example.com", Age: 31}
+	if err := repo.Create(context.Background(), &u); !errors.Is(err, store.ErrDuplicateEmail) {
+		t.Errorf("Create error = %v, want ErrDuplicateEmail", err)
+	}
+}
+
+func TestUpdateStaleVersion(t *testing.T) {
+	repo := dbtest.NewRepository(t, "testdata/users.yaml")
+	ctx := context.Background()
+
+	carol, err := repo.Get(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := carol
+
+	carol.Age++
+	if err := repo.Update(ctx, &carol); err != nil {
+		t.Fatal(err)
+	}
+	if carol.Version != 5 {
+		t.Errorf("Version after Update = %d, want 5", carol.Version)
+	}
+
+	stale.Name = "Carol Smith"
+	if err := repo.Update(ctx, &stale); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Update with version %d: error = %v, want ErrConflict", stale.Version, err)
+	}
+}
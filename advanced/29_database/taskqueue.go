@@ -0,0 +1,205 @@
+// taskqueue.go - A Durable Task Queue
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go_lang_tutorial/internal/database"
+	"go_lang_tutorial/internal/taskqueue"
+	"go_lang_tutorial/internal/workerpool"
+)
+
+// ===== TASK QUEUE =====
+// The Job and Result channels of 21_advanced_concurrency vanish when the
+// process exits. internal/taskqueue keeps tasks in the tasks table instead:
+// a consumer leases a task, which hides it for the visibility timeout, and
+// acknowledges it when done. A failed task is retried with backoff and,
+// after its last attempt, moved to the dead_tasks table. Priorities decide
+// what runs first; a delay hides a task until later.
+
+func taskQueueDemo(ctx context.Context, db *sql.DB) error {
+	q := taskqueue.New(db, "emails",
+		taskqueue.WithMaxAttempts(3),
+		taskqueue.WithRetryDelay(20*time.Millisecond, 100*time.Millisecond),
+		taskqueue.WithPollInterval(10*time.Millisecond),
+	)
+
+	tasks := []struct {
+		payload string
+		opts    taskqueue.EnqueueOptions
+	}{
+		{"welcome alice", taskqueue.EnqueueOptions{}},
+		{"welcome bob", taskqueue.EnqueueOptions{}},
+		{"reset password carol", taskqueue.EnqueueOptions{Priority: 10}},
+		{"newsletter", taskqueue.EnqueueOptions{Delay: 150 * time.Millisecond}},
+		{"flaky smtp", taskqueue.EnqueueOptions{}},
+		{"unreachable host", taskqueue.EnqueueOptions{}},
+		{"invalid address", taskqueue.EnqueueOptions{}},
+	}
+	for _, t := range tasks {
+		if _, err := q.Enqueue(ctx, []byte(t.payload), t.opts); err != nil {
+			return err
+		}
+	}
+
+	// One worker, so the tasks run in priority order
+	pool := workerpool.New[struct{}](workerpool.Options{Workers: 1})
+	start := time.Now()
+	var flaky atomic.Int32
+	handle := func(ctx context.Context, t *taskqueue.Task) error {
+		fmt.Printf("  %4dms  #%d %-20s attempt %d\n",
+			time.Since(start).Milliseconds(), t.ID, t.Payload, t.Attempts)
+		switch string(t.Payload) {
+		case "flaky smtp":
+			if flaky.Add(1) < 3 {
+				return errors.New("smtp: try again later")
+			}
+		case "unreachable host":
+			return errors.New("dial tcp: no route to host")
+		case "invalid address":
+			return workerpool.Permanent(errors.New("no @ in address"))
+		}
+		return nil
+	}
+
+	consumeCtx, cancel := context.WithTimeout(ctx, 400*time.Millisecond)
+	defer cancel()
+	q.Consume(consumeCtx, pool, handle)
+	if err := pool.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  Stats: %+v\n", stats)
+
+	dead, err := q.DeadLetters(ctx, 10)
+	if err != nil {
+		return err
+	}
+	for _, t := range dead {
+		fmt.Printf("  Dead: #%d %s after %d attempt(s): %s\n", t.ID, t.Payload, t.Attempts, t.LastError)
+	}
+	return nil
+}
+
+// queueCommand works with a task queue in a database file, e.g.
+//
+//	go run 29_database.go queue enqueue -db app.db -priority 5 "hello"
+//	go run 29_database.go queue work -db app.db -workers 4
+//	go run 29_database.go queue stats -db app.db
+//	go run 29_database.go queue dead -db app.db
+//	go run 29_database.go queue requeue -db app.db 42
+//
+// Several work processes can share one database; each task goes to one of
+// them at a time.
+func queueCommand(args []string) error {
+	const usage = "usage: queue enqueue|work|stats|dead|requeue [-db FILE] [-queue NAME] ..."
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	action, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("queue "+action, flag.ExitOnError)
+	dbPath := fs.String("db", "app.db", "SQLite database file")
+	name := fs.String("queue", "default", "queue name")
+	priority := fs.Int("priority", 0, "enqueue: higher runs first")
+	delay := fs.Duration("delay", 0, "enqueue: hide the task for this long")
+	workers := fs.Int("workers", 4, "work: number of workers")
+	visibility := fs.Duration("visibility", taskqueue.DefaultVisibilityTimeout, "work: lease duration")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := database.OpenMigrated(ctx, *dbPath, database.PoolOptions{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	q := taskqueue.New(db, *name, taskqueue.WithVisibilityTimeout(*visibility))
+
+	switch action {
+	case "enqueue":
+		if fs.NArg() == 0 {
+			return errors.New("usage: queue enqueue [-db FILE] [-queue NAME] [-priority N] [-delay D] PAYLOAD...")
+		}
+		for _, payload := range fs.Args() {
+			id, err := q.Enqueue(ctx, []byte(payload), taskqueue.EnqueueOptions{Priority: *priority, Delay: *delay})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("enqueued task %d\n", id)
+		}
+		return nil
+
+	case "work":
+		// A stand-in handler: real workers would decode the payload and act
+		// on it
+		pool := workerpool.New[struct{}](workerpool.Options{Workers: *workers})
+		fmt.Printf("working on queue %q with %d workers, press Ctrl+C to stop\n", *name, *workers)
+		err := q.Consume(ctx, pool, func(ctx context.Context, t *taskqueue.Task) error {
+			fmt.Printf("task %d (attempt %d/%d): %s\n", t.ID, t.Attempts, t.MaxAttempts, t.Payload)
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+
+		// Finish the running tasks; those still queued were released
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return pool.Shutdown(shutdownCtx)
+
+	case "stats":
+		s, err := q.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ready %d, delayed %d, leased %d, dead %d\n", s.Ready, s.Delayed, s.Leased, s.Dead)
+		return nil
+
+	case "dead":
+		dead, err := q.DeadLetters(ctx, 100)
+		if err != nil {
+			return err
+		}
+		for _, t := range dead {
+			fmt.Printf("%d\t%s\t%d attempts\t%s\t%s\n", t.ID, t.FailedAt.Format(time.DateTime), t.Attempts,
+				strings.ReplaceAll(t.LastError, "\n", " "), t.Payload)
+		}
+		return nil
+
+	case "requeue":
+		if fs.NArg() == 0 {
+			return errors.New("usage: queue requeue [-db FILE] [-queue NAME] ID...")
+		}
+		for _, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("queue requeue: invalid task ID %q", arg)
+			}
+			if err := q.Requeue(ctx, id); err != nil {
+				return err
+			}
+			fmt.Printf("requeued task %d\n", id)
+		}
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
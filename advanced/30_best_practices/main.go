@@ -5,7 +5,11 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
 	"time"
+
+	"go_lang_tutorial/internal/config"
+	"go_lang_tutorial/internal/store"
 )
 
 // ===== GO BEST PRACTICES =====
@@ -50,19 +54,21 @@ import (
 // ===== EXAMPLES =====
 
 // Good: Clear, descriptive name
-type UserRepository struct {
-	db Database
-}
+// (internal/store has the full SQLite-backed implementation)
+type UserRepository = store.UserRepository
 
 // Bad: Unclear abbreviation
 // type UsrRepo struct {}
 
 // Good: Interface where it's used
-type Database interface {
-	Query(sql string) ([]Row, error)
-}
-
-type Row struct{}
+// store.Database is satisfied by both *sql.DB and *sql.Tx:
+//
+//	type Database interface {
+//		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+//		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+//		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+//	}
+type Database = store.Database
 
 // Good: Small, focused interface
 type Reader interface {
@@ -114,15 +120,13 @@ func parseConfig(data []byte) (*Config, error) {
 
 // Good: Constructor pattern
 func NewUserRepository(db Database) *UserRepository {
-	return &UserRepository{db: db}
+	return store.NewUserRepository(db)
 }
 
 // Good: Options pattern for many parameters
-type ServerOptions struct {
-	Port         int
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-}
+// ServerOptions lives in internal/config so the HTTP lessons can share it;
+// config.Load fills it from defaults, a file, the environment and flags.
+type ServerOptions = config.ServerOptions
 
 func NewServer(opts ServerOptions) *Server {
 	return &Server{
@@ -211,6 +215,20 @@ func main() {
 	)
 	fmt.Printf("Server: %+v\n", server)
 
+	// Layered configuration: defaults < file < env < flags
+	// Try: APP_PORT=9090 go run 30_best_practices.go -read-timeout=3s
+	opts, err := config.Load(ServerOptions{
+		Port:         8080,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		AuthToken:    "dev-token",
+	}, os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Printf("Server from config: %+v\n", NewServer(opts))
+	}
+
 	// Zero value usage
 	var counter Counter
 	counter.Increment()
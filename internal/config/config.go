@@ -0,0 +1,313 @@
+// Package config loads server settings by layering, from lowest to highest
+// precedence: built-in defaults, a config file, environment variables and
+// command-line flags.
+//
+// Every field of ServerOptions carries a `config:"name"` tag. The same name is
+// used in all layers:
+//
+//	file:  read_timeout: 10s          (YAML-ish)  or  {"read_timeout": "10s"}
+//	env:   APP_READ_TIMEOUT=10s
+//	flag:  -read-timeout=10s
+//
+// The config file is chosen with -config or APP_CONFIG.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prepended to the upper-cased field name to form the
+// environment variable for that field.
+const EnvPrefix = "APP_"
+
+// ServerOptions holds the settings shared by the HTTP server lessons.
+type ServerOptions struct {
+	Port         int           `config:"port" usage:"TCP port to listen on"`
+	ReadTimeout  time.Duration `config:"read_timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout time.Duration `config:"write_timeout" usage:"maximum duration for writing a response"`
+	IdleTimeout  time.Duration `config:"idle_timeout" usage:"keep-alive idle timeout"`
+	AuthToken    string        `config:"auth_token" usage:"token expected in the Authorization header"`
+	StaticDir    string        `config:"static_dir" usage:"directory served under /static/"`
+	Store        string        `config:"store" usage:"storage driver: sqlite (default) or memory"`
+	Database     string        `config:"database" usage:"SQLite database file, or :memory:"`
+	QueryTimeout time.Duration `config:"query_timeout" usage:"default timeout for a single database query"`
+
+	// Connection pool; zero keeps the database/sql default
+	DBMaxOpenConns    int           `config:"db_max_open_conns" usage:"maximum open database connections"`
+	DBMaxIdleConns    int           `config:"db_max_idle_conns" usage:"maximum idle database connections"`
+	DBConnMaxLifetime time.Duration `config:"db_conn_max_lifetime" usage:"maximum lifetime of a database connection"`
+	DBConnMaxIdleTime time.Duration `config:"db_conn_max_idle_time" usage:"maximum idle time of a database connection"`
+
+	// Scheduled snapshots of the database; a zero interval disables them
+	BackupDir      string        `config:"backup_dir" usage:"directory for scheduled database snapshots"`
+	BackupInterval time.Duration `config:"backup_interval" usage:"time between database snapshots (0 disables)"`
+	BackupKeep     int           `config:"backup_keep" usage:"number of snapshots to keep (0 keeps all)"`
+
+	// SQL query log; slow queries are logged even without log_queries
+	LogQueries bool          `config:"log_queries" usage:"log every SQL statement"`
+	SlowQuery  time.Duration `config:"slow_query" usage:"log SQL statements slower than this (0 disables)"`
+}
+
+// Addr returns the listen address for http.Server.
+func (o ServerOptions) Addr() string {
+	return fmt.Sprintf(":%d", o.Port)
+}
+
+// Validate reports every field holding an unusable value.
+func (o ServerOptions) Validate() error {
+	var errs ValidationError
+
+	if o.Port < 1 || o.Port > 65535 {
+		errs.add("port", "must be between 1 and 65535, got %d", o.Port)
+	}
+	if o.ReadTimeout <= 0 {
+		errs.add("read_timeout", "must be positive, got %v", o.ReadTimeout)
+	}
+	if o.WriteTimeout <= 0 {
+		errs.add("write_timeout", "must be positive, got %v", o.WriteTimeout)
+	}
+	if o.IdleTimeout < 0 {
+		errs.add("idle_timeout", "must not be negative, got %v", o.IdleTimeout)
+	}
+	if o.QueryTimeout < 0 {
+		errs.add("query_timeout", "must not be negative, got %v", o.QueryTimeout)
+	}
+	if o.DBMaxOpenConns < 0 {
+		errs.add("db_max_open_conns", "must not be negative, got %d", o.DBMaxOpenConns)
+	}
+	if o.DBMaxIdleConns < 0 {
+		errs.add("db_max_idle_conns", "must not be negative, got %d", o.DBMaxIdleConns)
+	}
+	if o.DBMaxOpenConns > 0 && o.DBMaxIdleConns > o.DBMaxOpenConns {
+		errs.add("db_max_idle_conns", "must not exceed db_max_open_conns (%d), got %d", o.DBMaxOpenConns, o.DBMaxIdleConns)
+	}
+	if o.DBConnMaxLifetime < 0 {
+		errs.add("db_conn_max_lifetime", "must not be negative, got %v", o.DBConnMaxLifetime)
+	}
+	if o.DBConnMaxIdleTime < 0 {
+		errs.add("db_conn_max_idle_time", "must not be negative, got %v", o.DBConnMaxIdleTime)
+	}
+	if o.BackupInterval < 0 {
+		errs.add("backup_interval", "must not be negative, got %v", o.BackupInterval)
+	}
+	if o.BackupInterval > 0 && o.BackupDir == "" {
+		errs.add("backup_dir", "must be set when backup_interval is")
+	}
+	if o.BackupKeep < 0 {
+		errs.add("backup_keep", "must not be negative, got %d", o.BackupKeep)
+	}
+	if o.SlowQuery < 0 {
+		errs.add("slow_query", "must not be negative, got %v", o.SlowQuery)
+	}
+	switch o.Store {
+	case "", "sqlite", "memory":
+	default:
+		errs.add("store", "must be sqlite or memory, got %q", o.Store)
+	}
+	if o.AuthToken == "" {
+		errs.add("auth_token", "must not be empty")
+	}
+
+	return errs.orNil()
+}
+
+// Load builds ServerOptions from defaults, the config file, the environment
+// and args (usually os.Args[1:]).
+func Load(defaults ServerOptions, args []string) (ServerOptions, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	return LoadFlagSet(fs, defaults, args)
+}
+
+// LoadFlagSet is like Load but parses args with fs, so callers can register
+// their own flags alongside the config flags.
+func LoadFlagSet(fs *flag.FlagSet, defaults ServerOptions, args []string) (ServerOptions, error) {
+	opts := defaults
+	fields := fieldsOf(&opts)
+
+	configPath := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to a config file (JSON or key: value)")
+
+	// Flags are only recorded while parsing; they are applied last so that
+	// they override the file and environment regardless of argument order.
+	var fromFlags []setting
+	for _, f := range fields {
+		f := f
+		record := func(s string) error {
+			fromFlags = append(fromFlags, setting{field: f, value: s, source: "flag -" + f.flagName()})
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(f.flagName(), f.usage, record) // -log-queries means true
+		} else {
+			fs.Func(f.flagName(), f.usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	var errs ValidationError
+
+	if *configPath != "" {
+		fromFile, unknown, err := readFile(*configPath, fields)
+		if err != nil {
+			return opts, err
+		}
+		errs.Fields = append(errs.Fields, unknown...)
+		errs.apply(fromFile)
+	}
+
+	var fromEnv []setting
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.envName()); ok {
+			fromEnv = append(fromEnv, setting{field: f, value: v, source: "env " + f.envName()})
+		}
+	}
+	errs.apply(fromEnv)
+	errs.apply(fromFlags)
+
+	// Validate the merged result too, skipping fields that already failed
+	// to parse so that each bad value is reported once.
+	if err := opts.Validate(); err != nil {
+		for _, fe := range err.(*ValidationError).Fields {
+			if !errs.has(fe.Field) {
+				errs.Fields = append(errs.Fields, fe)
+			}
+		}
+	}
+
+	return opts, errs.orNil()
+}
+
+// ===== FIELDS =====
+
+type field struct {
+	name  string
+	usage string
+	value reflect.Value
+}
+
+func fieldsOf(opts *ServerOptions) []field {
+	v := reflect.ValueOf(opts).Elem()
+	t := v.Type()
+
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("config")
+		if name == "" {
+			continue
+		}
+		fields = append(fields, field{
+			name:  name,
+			usage: t.Field(i).Tag.Get("usage"),
+			value: v.Field(i),
+		})
+	}
+	return fields
+}
+
+func (f field) envName() string  { return EnvPrefix + strings.ToUpper(f.name) }
+func (f field) flagName() string { return strings.ReplaceAll(f.name, "_", "-") }
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f field) set(s string) error {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(s)
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		f.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.value.Type())
+	}
+	return nil
+}
+
+// setting is a raw value for one field, remembered with where it came from
+// so that errors can point at the offending layer.
+type setting struct {
+	field  field
+	value  string
+	source string
+}
+
+// ===== ERRORS =====
+
+// FieldError describes one invalid field.
+type FieldError struct {
+	Field   string
+	Source  string // e.g. "env APP_PORT"; empty for the merged result
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Field, e.Source, e.Message)
+}
+
+// ValidationError collects every FieldError found while loading, so that
+// users can fix all of them in one go.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid configuration:\n  " + strings.Join(msgs, "\n  ")
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) apply(settings []setting) {
+	for _, s := range settings {
+		if err := s.field.set(s.value); err != nil {
+			e.Fields = append(e.Fields, FieldError{Field: s.field.name, Source: s.source, Message: err.Error()})
+		}
+	}
+}
+
+func (e *ValidationError) has(field string) bool {
+	for _, f := range e.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
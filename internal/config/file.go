@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go_lang_tutorial/internal/yamlish"
+)
+
+// readFile parses a config file into settings. Files ending in .json must
+// hold a single object; anything else is read as YAML-ish "key: value"
+// lines where blank lines, lines starting with # and trailing " # comments"
+// are ignored. Keys that
+// name no field are returned as FieldErrors, sorted by key.
+func readFile(path string, fields []field) ([]setting, []FieldError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var raw map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		raw, err = parseJSON(data)
+	} else {
+		raw, err = parseKeyValue(data)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	byName := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var settings []setting
+	var unknown []FieldError
+	for _, key := range keys {
+		source := "file " + path
+		f, ok := byName[key]
+		if !ok {
+			unknown = append(unknown, FieldError{Field: key, Source: source, Message: "unknown key"})
+			continue
+		}
+		settings = append(settings, setting{field: f, value: raw[key], source: source})
+	}
+
+	return settings, unknown, nil
+}
+
+func parseJSON(data []byte) (map[string]string, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]string, len(obj))
+	for key, msg := range obj {
+		// Strings are unquoted; numbers and booleans are kept as written
+		var s string
+		if err := json.Unmarshal(msg, &s); err == nil {
+			raw[key] = s
+		} else {
+			raw[key] = string(msg)
+		}
+	}
+	return raw, nil
+}
+
+func parseKeyValue(data []byte) (map[string]string, error) {
+	raw := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line)
+		}
+		value, _, err := yamlish.Scalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		raw[strings.TrimSpace(key)] = value
+	}
+
+	return raw, scanner.Err()
+}
@@ -0,0 +1,41 @@
+package config
+
+import "testing"
+
+func TestParseKeyValue(t *testing.T) {
+	raw, err := parseKeyValue([]byte(`# server settings
+port: 9090             # comment after a number
+database: :memory:
+auth_token: "s3cret # not a comment"
+static_dir: 'it''s'    # single-quoted
+
+store:                 # empty value
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"port":       "9090",
+		"database":   ":memory:",
+		"auth_token": "s3cret # not a comment",
+		"static_dir": "it's",
+		"store":      "",
+	}
+	if len(raw) != len(want) {
+		t.Errorf("parseKeyValue = %q, want %q", raw, want)
+	}
+	for key, value := range want {
+		if got, ok := raw[key]; !ok || got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestParseKeyValueErrors(t *testing.T) {
+	for _, in := range []string{"port 9090", `auth_token: "unterminated`, `auth_token: "a" b`} {
+		if raw, err := parseKeyValue([]byte(in)); err == nil {
+			t.Errorf("parseKeyValue(%q) = %q, want an error", in, raw)
+		}
+	}
+}
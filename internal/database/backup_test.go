@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFileSpecialCharacters(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range []string{"plain.db", "what?.db", "issue #1.db", "100%.db"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			db, err := OpenMigrated(ctx, path, PoolOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			if _, err := os.Stat(path); err != nil {
+				t.Fatalf("database not created under its own name: %v", err)
+			}
+			if err := VerifyFile(ctx, path); err != nil {
+				t.Errorf("VerifyFile(%q) = %v", path, err)
+			}
+		})
+	}
+}
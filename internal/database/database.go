@@ -0,0 +1,107 @@
+// Package database opens the SQLite databases used by the lessons with
+// consistent settings.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+
+	"go_lang_tutorial/internal/migrate"
+	"go_lang_tutorial/internal/sqllog"
+	"go_lang_tutorial/internal/store"
+)
+
+// Option configures Open.
+type Option func(*openOptions)
+
+type openOptions struct {
+	queryLog *sqllog.Options
+}
+
+// WithQueryLog logs the statements run on the database (see internal/sqllog).
+func WithQueryLog(opts sqllog.Options) Option {
+	return func(o *openOptions) {
+		o.queryLog = &opts
+	}
+}
+
+// fileDSN builds a file: URI for path. The path is escaped, since a ? or
+// # in a file name would otherwise start the query or fragment; SQLite
+// decodes it again.
+func fileDSN(path, query string) string {
+	u := url.URL{Scheme: "file", Opaque: (&url.URL{Path: path}).EscapedPath(), RawQuery: query}
+	return u.String()
+}
+
+// Open opens the SQLite database at path (a file name or ":memory:"),
+// configures its connection pool and checks that it is reachable.
+func Open(ctx context.Context, path string, pool PoolOptions, opts ...Option) (*sql.DB, error) {
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dsn := path
+	if path != ":memory:" && !strings.HasPrefix(path, "file:") {
+		// Wait for locks held by other connections instead of failing at once
+		dsn = fileDSN(path, "_busy_timeout=5000")
+	}
+
+	var db *sql.DB
+	if o.queryLog != nil {
+		db = sql.OpenDB(sqllog.NewConnector(&sqlite3.SQLiteDriver{}, dsn, *o.queryLog))
+	} else {
+		var err error
+		if db, err = sql.Open("sqlite3", dsn); err != nil {
+			return nil, fmt.Errorf("open %s: %w", path, err)
+		}
+	}
+
+	if isMemory(path) {
+		// Every connection to an in-memory database gets its own empty
+		// database, so the pool must never grow past one connection, and
+		// that connection must never be closed.
+		pool = PoolOptions{MaxOpenConns: 1, MaxIdleConns: 1}
+	}
+	pool.apply(db)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// OpenMigrated is Open followed by applying all pending migrations and
+// preparing the full-text search index (when built with sqlite_fts5).
+func OpenMigrated(ctx context.Context, path string, pool PoolOptions, opts ...Option) (*sql.DB, error) {
+	db, err := Open(ctx, path, pool, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.New(db)
+	if err == nil {
+		_, err = m.Up(ctx)
+	}
+	if err == nil {
+		if err = store.EnsureSearchIndex(ctx, db); errors.Is(err, store.ErrSearchUnavailable) {
+			err = nil
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func isMemory(path string) bool {
+	return path == ":memory:" || strings.Contains(path, "mode=memory")
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go_lang_tutorial/internal/expvarfunc"
+)
+
+// ===== POOL CONFIGURATION =====
+
+// PoolOptions tunes the connection pool of a *sql.DB. Zero values keep the
+// database/sql defaults (unlimited open connections, 2 idle connections,
+// connections never expire).
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (p PoolOptions) apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// ===== POOL STATISTICS =====
+
+// PoolStats is sql.DBStats in a JSON-friendly form.
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMs     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+func Stats(db *sql.DB) PoolStats {
+	s := db.Stats()
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     float64(s.WaitDuration) / float64(time.Millisecond),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// PublishStats exposes the pool statistics of db as the expvar variable
+// name, which shows up at /debug/vars on http.DefaultServeMux. Publishing
+// the same name again (e.g. after reopening the database) switches the
+// variable to the new db.
+func PublishStats(name string, db *sql.DB) {
+	expvarfunc.Publish(name, func() any { return Stats(db) })
+}
+
+// StatsHandler serves the current pool statistics of db as JSON.
+func StatsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Stats(db))
+	}
+}
+
+// WatchPool logs a warning whenever callers had to wait for a free
+// connection during the last interval, which means MaxOpenConns is too low
+// for the load. It returns when ctx is done.
+func WatchPool(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := db.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := db.Stats()
+		if waits := now.WaitCount - last.WaitCount; waits > 0 {
+			log.Printf("database: %d queries waited %v for a connection in the last %v (open %d/%d, in use %d); consider raising max open connections",
+				waits, now.WaitDuration-last.WaitDuration, interval,
+				now.OpenConnections, now.MaxOpenConnections, now.InUse)
+		}
+		last = now
+	}
+}
@@ -0,0 +1,88 @@
+// Package dbtest sets up databases for data-layer tests. Each test gets its
+// own migrated in-memory SQLite database, optionally filled from fixture
+// files, which is closed automatically when the test ends:
+//
+//	func TestFindByEmail(t *testing.T) {
+//		repo := dbtest.NewRepository(t, "testdata/users.yaml")
+//
+//		u, err := repo.FindByEmail(context.Background(), "alice@example.com")
+//		...
+//	}
+//
+// In-memory databases are private to the *sql.DB that opened them, so tests
+// using dbtest can run in parallel without seeing each other's rows.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"testing"
+
+	"go_lang_tutorial/internal/database"
+	"go_lang_tutorial/internal/store"
+)
+
+// New returns an empty in-memory database with all migrations applied.
+// Pass database.WithQueryLog to see the statements a test runs.
+func New(t testing.TB, opts ...database.Option) *sql.DB {
+	t.Helper()
+
+	db, err := database.OpenMigrated(context.Background(), ":memory:", database.PoolOptions{}, opts...)
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// NewRepository returns a UserRepository on a new database loaded with the
+// given fixture files.
+func NewRepository(t testing.TB, fixtures ...string) *store.UserRepository {
+	t.Helper()
+
+	db := New(t)
+	Load(t, db, fixtures...)
+	return store.NewUserRepository(db)
+}
+
+// Load inserts the fixture files at paths into db, failing the test on any
+// error. Paths are relative to the package directory when run by go test.
+func Load(t testing.TB, db *sql.DB, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("dbtest: %v", err)
+		}
+		load(t, db, path, data)
+	}
+}
+
+// LoadFS is like Load but reads the files from fsys, e.g. an embed.FS.
+func LoadFS(t testing.TB, db *sql.DB, fsys fs.FS, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatalf("dbtest: %v", err)
+		}
+		load(t, db, name, data)
+	}
+}
+
+func load(t testing.TB, db *sql.DB, name string, data []byte) {
+	t.Helper()
+
+	tables, err := ParseFixtures(name, data)
+	if err == nil {
+		err = InsertFixtures(context.Background(), db, tables)
+	}
+	if err != nil {
+		t.Fatalf("dbtest: load %s: %v", name, err)
+	}
+}
@@ -0,0 +1,235 @@
+package dbtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go_lang_tutorial/internal/dbtx"
+	"go_lang_tutorial/internal/sqlb"
+	"go_lang_tutorial/internal/yamlish"
+)
+
+// ===== FIXTURES =====
+// A fixture file maps table names to the rows to insert, in file order so
+// that rows can refer to rows of earlier tables. Files ending in .json hold
+// one object:
+//
+//	{
+//	  "users": [
+//	    {"id": 1, "name": "Alice", "email": "alice@example.com", "age": 30}
+//	  ],
+//	  "audit_log": [
+//	    {"user_id": 1, "action": "create", "actor": "system",
+//	     "data": {"name": "Alice"}, "created_at": "2024-01-01 10:00:00"}
+//	  ]
+//	}
+//
+// Nested objects and arrays are stored as JSON text. Anything else is read
+// as a small subset of YAML:
+//
+//	users:
+//	  - id: 1
+//	    name: Alice
+//	    email: alice@example.com
+//	  - name: Bob             # id assigned by SQLite
+//	    deleted_at: ~         # null
+//
+// Columns left out of a row get their default value.
+
+// Table holds the fixture rows for one table.
+type Table struct {
+	Name string
+	Rows []Row
+}
+
+// Row maps column names to values.
+type Row map[string]any
+
+// ParseFixtures parses a fixture file; name only selects the format.
+func ParseFixtures(name string, data []byte) ([]Table, error) {
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		return parseJSON(data)
+	}
+	return parseYAML(data)
+}
+
+// InsertFixtures inserts all rows in a single transaction, so a failing row
+// leaves db unchanged.
+func InsertFixtures(ctx context.Context, db *sql.DB, tables []Table) error {
+	return dbtx.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		for _, table := range tables {
+			for i, row := range table.Rows {
+				if err := insertRow(ctx, tx, table.Name, row); err != nil {
+					return fmt.Errorf("%s row %d: %w", table.Name, i+1, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func insertRow(ctx context.Context, tx *sql.Tx, table string, row Row) error {
+	columns := make([]string, 0, len(row))
+	for c := range row {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+
+	values := make([]any, len(columns))
+	for i, c := range columns {
+		values[i] = row[c]
+	}
+
+	query, args, err := sqlb.Insert(table).Columns(columns...).Values(values...).Build()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ===== JSON =====
+
+func parseJSON(data []byte) ([]Table, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	// Read the top-level object token by token to keep the table order
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("fixtures must be a JSON object of tables")
+	}
+
+	var tables []Table
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name := tok.(string) // Object keys are always strings
+
+		var rows []map[string]any
+		if err := dec.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+
+		table := Table{Name: name}
+		for _, r := range rows {
+			row := make(Row, len(r))
+			for column, v := range r {
+				if row[column], err = jsonValue(v); err != nil {
+					return nil, fmt.Errorf("table %s: %s: %w", name, column, err)
+				}
+			}
+			table.Rows = append(table.Rows, row)
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func jsonValue(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		return string(b), err
+	default:
+		return v, nil // string, bool or nil
+	}
+}
+
+// ===== YAML =====
+
+func parseYAML(data []byte) ([]Table, error) {
+	var (
+		tables []Table
+		table  *Table
+		row    Row
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// "users:" or "users: []" at the start of a line opens a table
+		if text[0] != ' ' && text[0] != '\t' {
+			name, rest, ok := strings.Cut(trimmed, ":")
+			rest = yamlish.StripComment(rest)
+			if !ok || (rest != "" && rest != "[]") {
+				return nil, fmt.Errorf("line %d: expected \"table:\"", line)
+			}
+			tables = append(tables, Table{Name: strings.TrimSpace(name)})
+			table, row = &tables[len(tables)-1], nil
+			continue
+		}
+		if table == nil {
+			return nil, fmt.Errorf("line %d: row outside of a table", line)
+		}
+
+		// "- column: value" starts a row, "column: value" continues it
+		if item, ok := strings.CutPrefix(trimmed, "-"); ok {
+			row = Row{}
+			table.Rows = append(table.Rows, row)
+			trimmed = strings.TrimSpace(item)
+			if trimmed == "" {
+				continue
+			}
+		}
+		if row == nil {
+			return nil, fmt.Errorf("line %d: expected \"- column: value\"", line)
+		}
+
+		column, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"column: value\"", line)
+		}
+		v, err := yamlScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		row[strings.TrimSpace(column)] = v
+	}
+
+	return tables, scanner.Err()
+}
+
+// yamlScalar converts a plain or quoted YAML value
+func yamlScalar(s string) (any, error) {
+	s, quoted, err := yamlish.Scalar(s)
+	if err != nil || quoted {
+		return s, err
+	}
+
+	switch s {
+	case "", "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
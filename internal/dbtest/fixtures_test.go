@@ -0,0 +1,38 @@
+package dbtest
+
+import "testing"
+
+func TestYAMLScalar(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"Alice", "Alice"},
+		{"42", int64(42)},
+		{"1.5", 1.5},
+		{"true", true},
+		{"~", nil},
+		{"", nil},
+		{"2024-03-01 12:00:00   # soft deleted", "2024-03-01 12:00:00"},
+		{`"Carol O'Brien"`, "Carol O'Brien"},
+		{`"Carol O'Brien"   # quoted for the apostrophe`, "Carol O'Brien"},
+		{`"a # not a comment"`, "a # not a comment"},
+		{`"say \"hi\"" # escaped quotes`, `say "hi"`},
+		{`'it''s' # doubled quote`, "it's"},
+		{`'#1'`, "#1"},
+	}
+	for _, tt := range tests {
+		got, err := yamlScalar(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("yamlScalar(%q) = %#v, %v, want %#v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestYAMLScalarErrors(t *testing.T) {
+	for _, in := range []string{`"unterminated`, `'unterminated`, `"a" b`, `'a'#b`} {
+		if got, err := yamlScalar(in); err == nil {
+			t.Errorf("yamlScalar(%q) = %#v, want an error", in, got)
+		}
+	}
+}
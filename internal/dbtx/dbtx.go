@@ -0,0 +1,151 @@
+// Package dbtx runs functions inside database transactions.
+//
+// WithTx commits when the function returns nil and rolls back when it
+// returns an error or panics, so callers never call Commit or Rollback
+// themselves. Passing a *sql.Tx instead of a *sql.DB nests the call inside
+// that transaction using a SAVEPOINT: only the inner work is undone when the
+// inner function fails, and the outer transaction can carry on.
+//
+// Top-level transactions that fail because SQLite reports the database as
+// busy or locked are retried with exponential backoff and jitter. The
+// function may therefore run more than once and must not have side effects
+// outside the transaction.
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DB is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// RetryPolicy controls how busy or locked transactions are retried.
+type RetryPolicy struct {
+	Attempts  int           // Total tries, including the first
+	BaseDelay time.Duration // Delay before the first retry; doubles each time
+	MaxDelay  time.Duration // Upper bound for a single delay
+}
+
+// DefaultRetry is used by WithTx.
+var DefaultRetry = RetryPolicy{
+	Attempts:  8,
+	BaseDelay: 10 * time.Millisecond,
+	MaxDelay:  500 * time.Millisecond,
+}
+
+// WithTx runs fn in a transaction on db. If db is a *sql.Tx, fn runs in a
+// savepoint of that transaction instead and opts is ignored.
+func WithTx(ctx context.Context, db DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	switch d := db.(type) {
+	case *sql.Tx:
+		return withSavepoint(ctx, d, fn)
+	case beginner:
+		return withRetry(ctx, DefaultRetry, func() error {
+			return withTx(ctx, d, opts, fn)
+		})
+	default:
+		return fmt.Errorf("dbtx: %T cannot begin transactions", db)
+	}
+}
+
+func withTx(ctx context.Context, db beginner, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	return fn(tx)
+}
+
+// ===== SAVEPOINTS =====
+
+var savepointSeq atomic.Uint64
+
+func withSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) (err error) {
+	name := fmt.Sprintf("dbtx_sp_%d", savepointSeq.Add(1))
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	// ROLLBACK TO keeps the savepoint open, so it is released either way
+	rollback := func() {
+		tx.ExecContext(context.WithoutCancel(ctx), "ROLLBACK TO SAVEPOINT "+name)
+		tx.ExecContext(context.WithoutCancel(ctx), "RELEASE SAVEPOINT "+name)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+		if err != nil {
+			rollback()
+			return
+		}
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	}()
+
+	return fn(tx)
+}
+
+// ===== RETRIES =====
+
+// IsBusy reports whether err is SQLite's SQLITE_BUSY or SQLITE_LOCKED.
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+func withRetry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	delay := policy.BaseDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsBusy(err) || attempt >= policy.Attempts {
+			return err
+		}
+
+		// Sleep somewhere in [delay/2, delay] so that competing writers
+		// don't retry in lockstep
+		sleep := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(sleep):
+		}
+
+		delay *= 2
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
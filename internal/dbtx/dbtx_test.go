@@ -0,0 +1,254 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var errBusy = sqlite3.Error{Code: sqlite3.ErrBusy}
+
+// openDB opens a file database with an items table; busy_timeout 0 makes
+// SQLite report a locked database at once instead of waiting for it
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func insert(tx *sql.Tx, id int) error {
+	_, err := tx.Exec("INSERT INTO items (id) VALUES (?)", id)
+	return err
+}
+
+func items(t *testing.T, db *sql.DB) []int {
+	t.Helper()
+	rows, err := db.Query("SELECT id FROM items ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+	errFail := errors.New("fail")
+
+	if err := WithTx(ctx, db, nil, func(tx *sql.Tx) error { return insert(tx, 1) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		insert(tx, 2)
+		return errFail
+	}); !errors.Is(err, errFail) {
+		t.Errorf("WithTx = %v, want the function's error", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx swallowed the panic")
+			}
+		}()
+		WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+			insert(tx, 3)
+			panic("boom")
+		})
+	}()
+
+	if got, want := items(t, db), []int{1}; !slices.Equal(got, want) {
+		t.Errorf("items = %v, want %v", got, want)
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	errFail := errors.New("fail")
+
+	tests := []struct {
+		name string
+		fn   func(tx *sql.Tx) error
+		want []int
+	}{
+		{"nested success is kept", func(tx *sql.Tx) error {
+			return WithTx(context.Background(), tx, nil, func(tx *sql.Tx) error { return insert(tx, 2) })
+		}, []int{1, 2, 3}},
+		{"nested failure is rolled back", func(tx *sql.Tx) error {
+			err := WithTx(context.Background(), tx, nil, func(tx *sql.Tx) error {
+				insert(tx, 2)
+				return errFail
+			})
+			if !errors.Is(err, errFail) {
+				return fmt.Errorf("nested WithTx = %v, want errFail", err)
+			}
+			return nil
+		}, []int{1, 3}},
+		{"failure two levels down keeps the middle level", func(tx *sql.Tx) error {
+			return WithTx(context.Background(), tx, nil, func(tx *sql.Tx) error {
+				insert(tx, 2)
+				WithTx(context.Background(), tx, nil, func(tx *sql.Tx) error {
+					insert(tx, 4)
+					return errFail
+				})
+				return nil
+			})
+		}, []int{1, 2, 3}},
+		{"nested panic is rolled back", func(tx *sql.Tx) error {
+			func() {
+				defer func() { recover() }()
+				WithTx(context.Background(), tx, nil, func(tx *sql.Tx) error {
+					insert(tx, 2)
+					panic("boom")
+				})
+			}()
+			return nil
+		}, []int{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+
+			// The outer transaction carries on after the nested call
+			err := WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+				if err := insert(tx, 1); err != nil {
+					return err
+				}
+				if err := tt.fn(tx); err != nil {
+					return err
+				}
+				return insert(tx, 3)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := items(t, db); !slices.Equal(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	errOther := errors.New("constraint failed")
+
+	tests := []struct {
+		name  string
+		errs  []error // returned by successive calls; nil after the last
+		calls int
+		want  error
+	}{
+		{"success", nil, 1, nil},
+		{"busy then success", []error{errBusy, errBusy}, 3, nil},
+		{"wrapped busy", []error{fmt.Errorf("insert: %w", errBusy)}, 2, nil},
+		{"locked", []error{sqlite3.Error{Code: sqlite3.ErrLocked}}, 2, nil},
+		{"busy every time", []error{errBusy, errBusy, errBusy, errBusy}, 3, errBusy},
+		{"other errors are not retried", []error{errOther}, 1, errOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := withRetry(context.Background(), policy, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("withRetry = %v, want %v", err, tt.want)
+			}
+			if calls != tt.calls {
+				t.Errorf("fn ran %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestWithRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{Attempts: 10, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	calls := 0
+	err := withRetry(ctx, policy, func() error {
+		calls++
+		cancel()
+		return errBusy
+	})
+	if !errors.Is(err, context.Canceled) || !IsBusy(err) || calls != 1 {
+		t.Errorf("withRetry = %v after %d calls, want busy and context.Canceled after 1", err, calls)
+	}
+}
+
+// A writer blocked by another connection's transaction succeeds once the
+// lock is released
+func TestWithTxRetriesBusy(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, other := openDB(t, path), openDB(t, path)
+
+	lock, err := other.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Exec("INSERT INTO items (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { lock.Commit() })
+
+	calls := 0
+	err = WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		calls++
+		return insert(tx, 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls < 2 {
+		t.Errorf("fn ran %d times, want a retry while the database was locked", calls)
+	}
+	if got, want := items(t, db), []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("items = %v, want %v", got, want)
+	}
+}
+
+func TestIsBusy(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errBusy, true},
+		{sqlite3.Error{Code: sqlite3.ErrLocked}, true},
+		{fmt.Errorf("begin: %w", errBusy), true},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{errors.New("database is locked"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsBusy(tt.err); got != tt.want {
+			t.Errorf("IsBusy(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Package expvarfunc publishes expvar variables computed by a function,
+// like expvar.Func, that can be published under the same name again.
+package expvarfunc
+
+import (
+	"expvar"
+	"sync"
+)
+
+var (
+	mu        sync.Mutex
+	published = make(map[string]func() any) // expvar name -> current func
+)
+
+// Publish exposes the result of f as the expvar variable name, which shows
+// up at /debug/vars on http.DefaultServeMux. expvar cannot unpublish a name
+// and panics on publishing it twice, so publishing the same name again
+// (e.g. for a database or pool replacing a closed one) switches the
+// variable to the new f instead.
+func Publish(name string, f func() any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := published[name]; !ok {
+		expvar.Publish(name, expvar.Func(func() any {
+			mu.Lock()
+			f := published[name]
+			mu.Unlock()
+			return f()
+		}))
+	}
+	published[name] = f
+}
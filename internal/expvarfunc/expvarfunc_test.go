@@ -0,0 +1,15 @@
+package expvarfunc
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestPublishTwice(t *testing.T) {
+	Publish("expvarfunc_test", func() any { return 1 })
+	Publish("expvarfunc_test", func() any { return 2 })
+
+	if got := expvar.Get("expvarfunc_test").String(); got != "2" {
+		t.Errorf("expvar value = %s after publishing again, want 2", got)
+	}
+}
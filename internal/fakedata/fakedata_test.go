@@ -0,0 +1,75 @@
+package fakedata
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go_lang_tutorial/internal/store"
+)
+
+func TestSameSeedSameUsers(t *testing.T) {
+	opts := []Option{WithAgeRange(20, 30), WithEmailDomains("test.local")}
+	a := New(42, opts...).Users(500)
+	b := New(42, opts...).Users(500)
+	if !slices.Equal(a, b) {
+		t.Error("two generators with seed 42 returned different users")
+	}
+
+	if c := New(43, opts...).Users(500); slices.Equal(a, c) {
+		t.Error("seeds 42 and 43 returned the same users")
+	}
+}
+
+func TestUsersValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		min, max int
+		domains  []string
+	}{
+		{"defaults", nil, 18, 80, defaultDomains},
+		{"age range", []Option{WithAgeRange(30, 35)}, 30, 35, defaultDomains},
+		{"reversed age range", []Option{WithAgeRange(35, 30)}, 30, 35, defaultDomains},
+		{"single age", []Option{WithAgeRange(40, 40)}, 40, 40, defaultDomains},
+		{"domains", []Option{WithEmailDomains("a.test", "b.test")}, 18, 80, []string{"a.test", "b.test"}},
+		{"no domains keeps the defaults", []Option{WithEmailDomains()}, 18, 80, defaultDomains},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Far more users than name combinations, so emails must be
+			// numbered to stay unique
+			users := New(1, tt.opts...).Users(5000)
+			emails := make(map[string]bool, len(users))
+			for _, u := range users {
+				if err := store.Validate(u); err != nil {
+					t.Fatalf("store.Validate(%+v) = %v", u, err)
+				}
+				if u.Age < tt.min || u.Age > tt.max {
+					t.Fatalf("%s is %d, want an age in %d-%d", u.Name, u.Age, tt.min, tt.max)
+				}
+				_, domain, _ := strings.Cut(u.Email, "@")
+				if !slices.Contains(tt.domains, domain) {
+					t.Fatalf("email %s, want a domain in %v", u.Email, tt.domains)
+				}
+				if emails[u.Email] {
+					t.Fatalf("email %s handed out twice", u.Email)
+				}
+				emails[u.Email] = true
+			}
+		})
+	}
+}
+
+func TestEmailPart(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Alice", "alice"},
+		{"O'Brien", "obrien"},
+		{"Zoë", "zo"},
+	}
+	for _, tt := range tests {
+		if got := emailPart(tt.in); got != tt.want {
+			t.Errorf("emailPart(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package leakcheck finds goroutines that outlive the code that started
+// them. In a test:
+//
+//	func TestPipeline(t *testing.T) {
+//		leakcheck.Check(t) // fails the test if goroutines are left behind
+//		...
+//	}
+//
+// Outside tests, take a Snapshot before and Wait on it afterwards.
+package leakcheck
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long Check gives goroutines to finish.
+const DefaultTimeout = time.Second
+
+// Snapshot records the goroutines running at one point in time.
+type Snapshot map[string]bool // Keyed by goroutine ID
+
+// Take returns a snapshot of the running goroutines.
+func Take() Snapshot {
+	s := make(Snapshot)
+	for id := range goroutines() {
+		s[id] = true
+	}
+	return s
+}
+
+// LeakError lists the stacks of leaked goroutines.
+type LeakError struct {
+	Stacks []string
+}
+
+func (e *LeakError) Error() string {
+	return fmt.Sprintf("%d goroutine(s) leaked:\n\n%s", len(e.Stacks), strings.Join(e.Stacks, "\n\n"))
+}
+
+// Wait waits up to timeout for every goroutine started since the snapshot
+// to exit, and returns a *LeakError for those still running.
+func (s Snapshot) Wait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for delay := time.Millisecond; ; delay *= 2 {
+		leaked := s.leaked()
+		if len(leaked) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &LeakError{Stacks: leaked}
+		}
+		time.Sleep(min(delay, 100*time.Millisecond, time.Until(deadline)))
+	}
+}
+
+func (s Snapshot) leaked() []string {
+	var stacks []string
+	for id, stack := range goroutines() {
+		if !s[id] {
+			stacks = append(stacks, stack)
+		}
+	}
+	return stacks
+}
+
+// Check fails t if goroutines started during the test are still running
+// DefaultTimeout after it ends. Call it first, so that it runs after all
+// other cleanup.
+func Check(t testing.TB) {
+	t.Helper()
+
+	s := Take()
+	t.Cleanup(func() {
+		if err := s.Wait(DefaultTimeout); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// goroutines returns the stack of every goroutine except the caller's,
+// keyed by goroutine ID
+func goroutines() map[string]string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	// Stacks are separated by blank lines; the first one is our own
+	stacks := bytes.Split(buf, []byte("\n\n"))
+	all := make(map[string]string, len(stacks))
+	for _, stack := range stacks[1:] {
+		// "goroutine 42 [chan receive]:"
+		header, _, _ := strings.Cut(string(stack), "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		all[fields[1]] = string(stack)
+	}
+	return all
+}
@@ -0,0 +1,245 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection to :memory: is its own database
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+// threeTables creates tables a, b and c, one per migration
+func threeTables() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_a.up.sql":   file("CREATE TABLE a (id INTEGER);"),
+		"0001_create_a.down.sql": file("DROP TABLE a;"),
+		"0002_create_b.up.sql":   file("CREATE TABLE b (id INTEGER);"),
+		"0002_create_b.down.sql": file("DROP TABLE b;"),
+		"0003_create_c.up.sql":   file("CREATE TABLE c (id INTEGER);"),
+		"0003_create_c.down.sql": file("DROP TABLE c;"),
+	}
+}
+
+func newMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	m, err := NewFromFS(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func versions(migrations []Migration) []int {
+	var vs []int
+	for _, mig := range migrations {
+		vs = append(vs, mig.Version)
+	}
+	return vs
+}
+
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"bad file name", fstest.MapFS{"create_a.up.sql": file("")}},
+		{"no up migration", fstest.MapFS{"0001_create_a.down.sql": file("DROP TABLE a;")}},
+		{"version used twice", fstest.MapFS{
+			"0001_create_a.up.sql": file("CREATE TABLE a (id INTEGER);"),
+			"0001_create_b.up.sql": file("CREATE TABLE b (id INTEGER);"),
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := Load(tt.fsys); err == nil {
+			t.Errorf("%s: Load succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m := newMigrator(t, db, threeTables())
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(versions(done), want) {
+		t.Fatalf("Up applied %v, want %v", versions(done), want)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Fatalf("second Up = %v, %v, want nothing to apply", versions(done), err)
+	}
+
+	// Down reverts the newest migrations first
+	tests := []struct {
+		steps  int
+		want   []int
+		tables []string
+	}{
+		{2, []int{3, 2}, []string{"a"}},
+		{5, []int{1}, nil},
+		{1, nil, nil},
+	}
+	for _, tt := range tests {
+		done, err := m.Down(ctx, tt.steps)
+		if err != nil {
+			t.Fatalf("Down(%d): %v", tt.steps, err)
+		}
+		if !slices.Equal(versions(done), tt.want) {
+			t.Errorf("Down(%d) reverted %v, want %v", tt.steps, versions(done), tt.want)
+		}
+		if got := tables(t, db); !slices.Equal(got, tt.tables) {
+			t.Errorf("tables after Down(%d) = %v, want %v", tt.steps, got, tt.tables)
+		}
+	}
+}
+
+func TestFailedMigrationLeavesNoTrace(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	fsys := threeTables()
+	fsys["0002_create_b.up.sql"] = file("CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1);")
+
+	done, err := newMigrator(t, db, fsys).Up(ctx)
+	if err == nil {
+		t.Fatal("Up succeeded, want the error of migration 2")
+	}
+	if want := []int{1}; !slices.Equal(versions(done), want) {
+		t.Errorf("Up applied %v before failing, want %v", versions(done), want)
+	}
+	if got, want := tables(t, db), []string{"a"}; !slices.Equal(got, want) {
+		t.Errorf("tables = %v, want %v", got, want)
+	}
+}
+
+func TestDownWithoutDownScript(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	fsys := threeTables()
+	delete(fsys, "0002_create_b.down.sql")
+	m := newMigrator(t, db, fsys)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Down(ctx, 3)
+	if !errors.Is(err, ErrNoDown) {
+		t.Errorf("Down = %v, want ErrNoDown", err)
+	}
+	if want := []int{3}; !slices.Equal(versions(done), want) {
+		t.Errorf("Down reverted %v before failing, want %v", versions(done), want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	edited := threeTables()
+	edited["0002_create_b.up.sql"] = file("CREATE TABLE b (id INTEGER, name TEXT);")
+	removed := threeTables()
+	delete(removed, "0003_create_c.up.sql")
+	delete(removed, "0003_create_c.down.sql")
+	added := threeTables()
+	added["0004_create_d.up.sql"] = file("CREATE TABLE d (id INTEGER);")
+	added["0004_create_d.down.sql"] = file("DROP TABLE d;")
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want error
+	}{
+		{"unchanged", threeTables(), nil},
+		{"edited after applying", edited, ErrChecksumMismatch},
+		{"applied migration removed", removed, ErrUnknownVersion},
+		{"new migration", added, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			if _, err := newMigrator(t, db, threeTables()).Up(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			m := newMigrator(t, db, tt.fsys)
+			if err := m.Verify(ctx); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+			// Up and Down refuse to touch a database that fails verification
+			if _, err := m.Up(ctx); !errors.Is(err, tt.want) {
+				t.Errorf("Up = %v, want %v", err, tt.want)
+			}
+			if _, err := m.Down(ctx, 1); !errors.Is(err, tt.want) {
+				t.Errorf("Down = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusReportsChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	if _, err := newMigrator(t, db, threeTables()).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := threeTables()
+	fsys["0002_create_b.up.sql"] = file("CREATE TABLE b (id INTEGER, name TEXT);")
+	statuses, err := newMigrator(t, db, fsys).Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.ChecksumOK != (s.Version != 2) {
+			t.Errorf("Status of %d: applied %v, checksum ok %v", s.Version, s.Applied, s.ChecksumOK)
+		}
+	}
+}
+
+// The embedded lesson schema loads and applies to an empty database
+func TestEmbedded(t *testing.T) {
+	m, err := New(openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
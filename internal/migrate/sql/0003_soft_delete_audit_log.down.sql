@@ -0,0 +1,14 @@
+DROP TABLE audit_log;
+
+-- Deleted users cannot be kept: their emails may clash with active users
+CREATE TABLE users_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	age INTEGER,
+	avatar TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO users_old (id, name, email, age, avatar)
+	SELECT id, name, email, age, avatar FROM users WHERE deleted_at IS NULL;
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
@@ -0,0 +1,28 @@
+-- Soft delete: a deleted user keeps its row with deleted_at set. The email
+-- only has to be unique among active users, which needs a partial index, so
+-- the table is rebuilt without the column-level UNIQUE constraint.
+CREATE TABLE users_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	age INTEGER,
+	avatar TEXT NOT NULL DEFAULT '',
+	deleted_at TIMESTAMP
+);
+INSERT INTO users_new (id, name, email, age, avatar)
+	SELECT id, name, email, age, avatar FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE UNIQUE INDEX users_email_active ON users (email) WHERE deleted_at IS NULL;
+
+-- One row per change to a user, with the user as it was afterwards
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	data TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX audit_log_user ON audit_log (user_id, id);
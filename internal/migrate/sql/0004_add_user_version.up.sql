@@ -0,0 +1,3 @@
+-- Incremented on every write; updates only succeed against the version
+-- the caller last read (optimistic concurrency control)
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP TABLE dead_tasks;
+DROP TABLE tasks;
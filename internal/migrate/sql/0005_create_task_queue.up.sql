@@ -0,0 +1,34 @@
+-- Durable task queue (internal/taskqueue). Times are Unix milliseconds so
+-- that SQLite compares them as numbers.
+--
+-- A task is visible, i.e. can be leased, once visible_at has passed.
+-- Leasing it moves visible_at to the end of the lease, so a worker that
+-- dies without acknowledging the task only hides it until then.
+CREATE TABLE tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue TEXT NOT NULL,
+	payload BLOB NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	visible_at INTEGER NOT NULL,
+	lease TEXT,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX tasks_next ON tasks (queue, priority DESC, visible_at, id);
+
+-- Tasks that failed max_attempts times or permanently, kept for inspection
+-- and requeueing
+CREATE TABLE dead_tasks (
+	id INTEGER PRIMARY KEY,
+	queue TEXT NOT NULL,
+	payload BLOB NOT NULL,
+	priority INTEGER NOT NULL,
+	attempts INTEGER NOT NULL,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	failed_at INTEGER NOT NULL
+);
+CREATE INDEX dead_tasks_queue ON dead_tasks (queue, failed_at);
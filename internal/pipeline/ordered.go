@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// ===== ORDERED PARALLEL MAP =====
+// FanOut and Merge spread work over several goroutines, but results come
+// out in whatever order the workers finish. OrderedMap numbers every input
+// value, lets workers finish in any order, and holds early results in a
+// reorder buffer until all values before them have been sent.
+
+// sequenced is a value tagged with its position in the input
+type sequenced[T any] struct {
+	seq uint64
+	v   T
+}
+
+// OrderedMap applies fn to the values of in using workers goroutines and
+// sends the results in input order. One slow value holds back the results
+// after it, so at most 2×workers values are in flight or waiting in the
+// reorder buffer at any time; reading from in pauses until the oldest
+// value is done. An error from fn fails the pipeline.
+func OrderedMap[T, U any](p *Pipeline, in <-chan T, workers int, fn func(context.Context, T) (U, error)) <-chan U {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// One slot per value between reading it from in and sending its result
+	slots := make(chan struct{}, 2*workers)
+	jobs := make(chan sequenced[T])
+	results := make(chan sequenced[U])
+	out := make(chan U)
+
+	// Number the input values
+	p.run(func(ctx context.Context) error {
+		defer close(jobs)
+		for seq := uint64(0); ; seq++ {
+			v, ok := recv(ctx, in)
+			if !ok || !send(ctx, slots, struct{}{}) {
+				return nil
+			}
+			if !send(ctx, jobs, sequenced[T]{seq, v}) {
+				return nil
+			}
+		}
+	})
+
+	// Process them in any order
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		p.run(func(ctx context.Context) error {
+			defer wg.Done()
+			for {
+				job, ok := recv(ctx, jobs)
+				if !ok {
+					return nil
+				}
+				u, err := fn(ctx, job.v)
+				if err != nil {
+					return err
+				}
+				if !send(ctx, results, sequenced[U]{job.seq, u}) {
+					return nil
+				}
+			}
+		})
+	}
+	p.run(func(ctx context.Context) error {
+		wg.Wait()
+		close(results)
+		return nil
+	})
+
+	// Send results in order, buffering those that finished early
+	p.run(func(ctx context.Context) error {
+		defer close(out)
+
+		pending := make(map[uint64]U, cap(slots))
+		var next uint64
+		for {
+			r, ok := recv(ctx, results)
+			if !ok {
+				return nil
+			}
+			pending[r.seq] = r.v
+
+			for u, ok := pending[next]; ok; u, ok = pending[next] {
+				delete(pending, next)
+				if !send(ctx, out, u) {
+					return nil
+				}
+				<-slots
+				next++
+			}
+		}
+	})
+	return out
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/leakcheck"
+)
+
+func TestOrderedMapKeepsOrder(t *testing.T) {
+	leakcheck.Check(t)
+
+	const n = 200
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+
+	p := New(context.Background())
+	// Random delays make workers finish out of order
+	squares := OrderedMap(p, Values(p, items...), 8, func(_ context.Context, v int) (int, error) {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		return v * v, nil
+	})
+
+	var got []int
+	Sink(p, squares, func(_ context.Context, v int) error {
+		got = append(got, v)
+		return nil
+	})
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+
+	if len(got) != n {
+		t.Fatalf("got %d results, want %d", len(got), n)
+	}
+	for i, v := range got {
+		if v != i*i {
+			t.Fatalf("result %d = %d, want %d", i, v, i*i)
+		}
+	}
+}
+
+func TestOrderedMapBoundsReadAhead(t *testing.T) {
+	leakcheck.Check(t)
+
+	const workers = 3
+	var emitted atomic.Int64
+	release := make(chan struct{})
+
+	p := New(context.Background())
+	source := Source(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := 0; ; i++ {
+			if !emit(i) {
+				return nil
+			}
+			emitted.Add(1)
+		}
+	})
+	// Value 0 is slow and holds back every result behind it
+	results := OrderedMap(p, source, workers, func(ctx context.Context, v int) (int, error) {
+		if v == 0 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+		}
+		return v, nil
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	// 2×workers values hold a slot; the numbering stage holds one more
+	// while it waits for a slot to free up
+	if got := emitted.Load(); got > 2*workers+1 {
+		t.Errorf("read %d values ahead of a stuck one, want at most %d", got, 2*workers+1)
+	}
+
+	close(release)
+	for want := 0; want < 20; want++ {
+		if got := <-results; got != want {
+			t.Fatalf("result = %d, want %d", got, want)
+		}
+	}
+	p.Stop()
+	if err := p.Wait(); err != nil {
+		t.Errorf("Wait() = %v", err)
+	}
+}
+
+func TestOrderedMapError(t *testing.T) {
+	leakcheck.Check(t)
+
+	errBoom := errors.New("boom")
+	p := New(context.Background())
+	results := OrderedMap(p, counter(p), 4, func(_ context.Context, v int) (int, error) {
+		if v == 7 {
+			return 0, errBoom
+		}
+		return v, nil
+	})
+	Sink(p, results, func(context.Context, int) error { return nil })
+
+	if err := p.Wait(); !errors.Is(err, errBoom) {
+		t.Errorf("Wait() = %v, want %v", err, errBoom)
+	}
+}
@@ -0,0 +1,332 @@
+// Package pipeline builds channel pipelines out of generic, cancellable
+// stages. Every stage runs in goroutines owned by a Pipeline:
+//
+//	p := pipeline.New(ctx)
+//	nums := pipeline.Values(p, 1, 2, 3, 4, 5)
+//	squares := pipeline.Map(p, nums, func(ctx context.Context, n int) (int, error) {
+//		return n * n, nil
+//	})
+//	pipeline.Sink(p, squares, func(ctx context.Context, n int) error {
+//		fmt.Println(n)
+//		return nil
+//	})
+//	err := p.Wait()
+//
+// The first error returned by any stage function cancels the pipeline and
+// is returned by Wait. Stages stop as soon as the pipeline's context is
+// done, so no goroutine is left blocked on a channel nobody reads: after
+// Wait returns, all of them have exited. A consumer that stops reading
+// early must call Stop (or cancel ctx) and then Wait.
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pipeline tracks the goroutines of a set of connected stages.
+type Pipeline struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	err       error
+	stopped   bool
+	parentErr error // Set if a stage was still running when ctx ended
+}
+
+// New returns an empty pipeline that is cancelled when ctx is.
+func New(ctx context.Context) *Pipeline {
+	p := &Pipeline{parent: ctx}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	return p
+}
+
+// Context returns the context stages run with. It is done once the
+// pipeline fails, is stopped or ctx is cancelled.
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Stop cancels all stages without it counting as an error, e.g. when the
+// consumer has seen enough.
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.cancel()
+}
+
+// Wait waits for every stage to exit and returns the first error, or the
+// context's error if ctx was cancelled before all stages had finished.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil && !p.stopped {
+		return p.parentErr
+	}
+	return p.err
+}
+
+// run starts fn in a goroutine tracked by the pipeline
+func (p *Pipeline) run(fn func(ctx context.Context) error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if err := fn(p.ctx); err != nil {
+			p.fail(err)
+		}
+
+		// A stage that returns after ctx ended may have been cut short;
+		// one that finished before did all its work
+		if parentErr := p.parent.Err(); parentErr != nil {
+			p.mu.Lock()
+			if p.parentErr == nil {
+				p.parentErr = parentErr
+			}
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// fail records the first error and cancels everything else. Errors after
+// Stop are usually just reactions to the cancellation and are dropped.
+func (p *Pipeline) fail(err error) {
+	p.mu.Lock()
+	if p.err == nil && !p.stopped {
+		p.err = err
+	}
+	p.mu.Unlock()
+	p.cancel()
+}
+
+// send and recv give up when ctx is done
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func recv[T any](ctx context.Context, in <-chan T) (T, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
+
+// ===== SOURCES =====
+
+// Source runs gen in its own goroutine and returns the values it emits.
+// emit returns false once the pipeline is cancelled; gen should then
+// return. The channel is closed when gen returns.
+func Source[T any](p *Pipeline, gen func(ctx context.Context, emit func(T) bool) error) <-chan T {
+	out := make(chan T)
+	p.run(func(ctx context.Context) error {
+		defer close(out)
+		return gen(ctx, func(v T) bool { return send(ctx, out, v) })
+	})
+	return out
+}
+
+// Values emits items in order.
+func Values[T any](p *Pipeline, items ...T) <-chan T {
+	return Source(p, func(ctx context.Context, emit func(T) bool) error {
+		for _, v := range items {
+			if !emit(v) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// ===== TRANSFORMATIONS =====
+
+// Map applies fn to every value of in, in order. An error from fn fails
+// the pipeline.
+func Map[T, U any](p *Pipeline, in <-chan T, fn func(context.Context, T) (U, error)) <-chan U {
+	out := make(chan U)
+	p.run(func(ctx context.Context) error {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return nil
+			}
+			u, err := fn(ctx, v)
+			if err != nil {
+				return err
+			}
+			if !send(ctx, out, u) {
+				return nil
+			}
+		}
+	})
+	return out
+}
+
+// Filter passes on the values of in for which keep returns true.
+func Filter[T any](p *Pipeline, in <-chan T, keep func(T) bool) <-chan T {
+	out := make(chan T)
+	p.run(func(ctx context.Context) error {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return nil
+			}
+			if keep(v) && !send(ctx, out, v) {
+				return nil
+			}
+		}
+	})
+	return out
+}
+
+// Batch groups the values of in into slices of size values. With maxWait
+// above zero, a partial batch is also sent once its first value has waited
+// that long, so a slow trickle of values still moves along. The last batch
+// may be short.
+func Batch[T any](p *Pipeline, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	if size < 1 {
+		size = 1
+	}
+
+	out := make(chan []T)
+	p.run(func(ctx context.Context) error {
+		defer close(out)
+
+		var (
+			batch   []T
+			timer   *time.Timer
+			timeout <-chan time.Time // nil, and so never ready, without a batch
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+			}
+			timeout = nil
+			if len(batch) == 0 {
+				return true
+			}
+			ok := send(ctx, out, batch)
+			batch = nil
+			return ok
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-timeout:
+				if !flush() {
+					return nil
+				}
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return nil
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					timeout = timer.C
+				}
+				if len(batch) == size && !flush() {
+					return nil
+				}
+			}
+		}
+	})
+	return out
+}
+
+// ===== FAN-OUT AND FAN-IN =====
+
+// FanOut distributes the values of in over n channels; each value goes to
+// exactly one of them, whichever is ready first. Give each output its own
+// stage to spread slow work over n goroutines, then Merge the results.
+func FanOut[T any](p *Pipeline, in <-chan T, n int) []<-chan T {
+	if n < 1 {
+		n = 1
+	}
+
+	outs := make([]<-chan T, n)
+	for i := range outs {
+		out := make(chan T)
+		outs[i] = out
+		p.run(func(ctx context.Context) error {
+			defer close(out)
+			for {
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return nil
+				}
+			}
+		})
+	}
+	return outs
+}
+
+// Merge combines the values of all ins into one channel, in no particular
+// order. It is closed once all ins are.
+func Merge[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		in := in
+		p.run(func(ctx context.Context) error {
+			defer wg.Done()
+			for {
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return nil
+				}
+			}
+		})
+	}
+
+	p.run(func(ctx context.Context) error {
+		wg.Wait()
+		close(out)
+		return nil
+	})
+	return out
+}
+
+// ===== SINKS =====
+
+// Sink calls fn for every value of in. Call Wait to wait for it to finish.
+func Sink[T any](p *Pipeline, in <-chan T, fn func(context.Context, T) error) {
+	p.run(func(ctx context.Context) error {
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return nil
+			}
+			if err := fn(ctx, v); err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/leakcheck"
+)
+
+// counter emits 0, 1, 2, ... until the pipeline is cancelled
+func counter(p *Pipeline) <-chan int {
+	return Source(p, func(ctx context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+}
+
+func double(_ context.Context, n int) (int, error) { return 2 * n, nil }
+
+func TestRunToCompletion(t *testing.T) {
+	leakcheck.Check(t)
+
+	p := New(context.Background())
+	doubled := Map(p, Values(p, 1, 2, 3, 4, 5), double)
+	even := Filter(p, doubled, func(n int) bool { return n%4 == 0 })
+
+	var got []int
+	Sink(p, even, func(_ context.Context, n int) error {
+		got = append(got, n)
+		return nil
+	})
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+	if want := []int{4, 8}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWaitIgnoresCancelAfterFinish(t *testing.T) {
+	leakcheck.Check(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx)
+	Sink(p, Values(p, 1, 2, 3), func(context.Context, int) error { return nil })
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait() = %v", err)
+	}
+
+	// Every stage finished before ctx ended, so nothing was cut short
+	cancel()
+	if err := p.Wait(); err != nil {
+		t.Errorf("Wait() after cancelling a finished pipeline = %v, want nil", err)
+	}
+}
+
+func TestCancelParent(t *testing.T) {
+	leakcheck.Check(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx)
+	seen := make(chan struct{})
+	Sink(p, Map(p, counter(p), double), func(_ context.Context, n int) error {
+		if n == 20 {
+			close(seen)
+		}
+		return nil
+	})
+
+	<-seen
+	cancel()
+	if err := p.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() = %v, want context.Canceled", err)
+	}
+}
+
+func TestStopAbandonedPipeline(t *testing.T) {
+	leakcheck.Check(t)
+
+	p := New(context.Background())
+	outs := FanOut(p, Map(p, counter(p), double), 3)
+	merged := Merge(p, outs...)
+
+	// Read a few values and walk away with every stage still blocked on a send
+	for i := 0; i < 5; i++ {
+		<-merged
+	}
+	p.Stop()
+	if err := p.Wait(); err != nil {
+		t.Errorf("Wait() after Stop = %v, want nil", err)
+	}
+}
+
+func TestStageError(t *testing.T) {
+	leakcheck.Check(t)
+
+	errBoom := errors.New("boom")
+	p := New(context.Background())
+	failing := Map(p, counter(p), func(_ context.Context, n int) (int, error) {
+		if n == 10 {
+			return 0, errBoom
+		}
+		return n, nil
+	})
+	Sink(p, Batch(p, failing, 4, time.Millisecond), func(context.Context, []int) error { return nil })
+
+	if err := p.Wait(); !errors.Is(err, errBoom) {
+		t.Errorf("Wait() = %v, want %v", err, errBoom)
+	}
+}
+
+func TestBatchMaxWait(t *testing.T) {
+	leakcheck.Check(t)
+
+	p := New(context.Background())
+	in := make(chan int)
+	batches := Batch(p, in, 10, 20*time.Millisecond)
+
+	in <- 1
+	in <- 2
+	// Far fewer than 10 values: the timer has to send the partial batch
+	select {
+	case got := <-batches:
+		if want := []int{1, 2}; !slices.Equal(got, want) {
+			t.Errorf("partial batch = %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no batch after maxWait")
+	}
+
+	close(in)
+	if err := p.Wait(); err != nil {
+		t.Errorf("Wait() = %v", err)
+	}
+}
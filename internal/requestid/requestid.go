@@ -0,0 +1,70 @@
+// Package requestid tags every HTTP request with an ID that follows it
+// through the logs: the HTTP access log, the SQL query log (internal/sqllog)
+// and, via the X-Request-ID header, upstream services and the client.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the request ID in requests and responses.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// New returns a random 16-character hex ID.
+func New() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// Middleware reuses a well-formed X-Request-ID sent by the client (or a
+// proxy in front of us) and generates one otherwise. The ID is stored in
+// the request context, set on the request header so that reverse proxies
+// pass it on, and echoed in the response header.
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+			r.Header.Set(Header, id)
+		}
+
+		w.Header().Set(Header, id)
+		next(w, r.WithContext(NewContext(r.Context(), id)))
+	}
+}
+
+// valid accepts short IDs of letters, digits, '-', '_' and '.', so a client
+// cannot inject arbitrary text into our logs
+func valid(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+// Package semaphore limits access to a shared resource of a fixed size,
+// such as a number of connections or a memory budget.
+//
+// A buffered channel (make(chan struct{}, n)) is the usual semaphore in
+// Go, but every acquisition takes exactly one unit and cannot be given up
+// when a context ends. Semaphore acquires any number of units, honours
+// contexts, and serves waiters in FIFO order: a large request is never
+// starved by a stream of small ones slipping past it.
+//
+//	sem := semaphore.New(10)
+//	if err := sem.Acquire(ctx, 4); err != nil {
+//		return err // ctx ended first; nothing is held
+//	}
+//	defer sem.Release(4)
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrTooLarge is returned by Acquire for requests larger than the
+	// semaphore, which could never be granted.
+	ErrTooLarge = errors.New("semaphore: request exceeds size")
+
+	// ErrNegative is returned by Acquire for a negative number of units.
+	ErrNegative = errors.New("semaphore: negative request")
+)
+
+// Semaphore is a weighted semaphore. Create one with New.
+type Semaphore struct {
+	size int64
+
+	mu      sync.Mutex
+	cur     int64     // Units held
+	waiters list.List // *waiter, oldest first
+}
+
+type waiter struct {
+	n     int64
+	ready chan struct{} // Closed once the units have been granted
+}
+
+// New returns a semaphore with size units.
+func New(size int64) *Semaphore {
+	return &Semaphore{size: size}
+}
+
+// Acquire takes n units, blocking until they are available or ctx is done.
+// On error nothing is held.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("%w: %d", ErrNegative, n)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if n > s.size {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %d > %d", ErrTooLarge, n, s.size)
+	}
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := &waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted while we were giving up; hand the units on
+		s.cur -= n
+	default:
+		s.waiters.Remove(elem)
+	}
+	// Either way the waiters behind us may fit now
+	s.notify()
+	return ctx.Err()
+}
+
+// TryAcquire takes n units without blocking and reports whether it did.
+// It fails while others are waiting, so it cannot jump the queue, and for
+// a negative n.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	if n < 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release returns n units. Releasing more than is held, or a negative
+// number of units, panics.
+func (s *Semaphore) Release(n int64) {
+	if n < 0 {
+		panic("semaphore: negative release")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		s.cur += n
+		panic("semaphore: released more than held")
+	}
+	s.notify()
+}
+
+// notify grants units to waiters in order, stopping at the first one that
+// does not fit so that it is not overtaken by smaller requests behind it
+func (s *Semaphore) notify() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(*waiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(front)
+		close(w.ready)
+	}
+}
@@ -0,0 +1,236 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n acquirers are queued on s
+func waitQueued(t *testing.T, s *Semaphore, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		queued := s.waiters.Len()
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters queued, want %d", queued, n)
+		}
+	}
+}
+
+// acquireAsync starts Acquire in a goroutine; its result arrives on the
+// returned channel
+func acquireAsync(ctx context.Context, s *Semaphore, n int64) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- s.Acquire(ctx, n) }()
+	return done
+}
+
+func assertBlocked(t *testing.T, done <-chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("%s returned %v, want it to keep waiting", what, err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func assertAcquired(t *testing.T, done <-chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s = %v", what, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s still waiting", what)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	s := New(10)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if !s.TryAcquire(6) {
+		t.Fatal("TryAcquire(6) with 6 units free = false")
+	}
+	if s.TryAcquire(1) {
+		t.Fatal("TryAcquire(1) on a full semaphore = true")
+	}
+	s.Release(10)
+	if !s.TryAcquire(10) {
+		t.Fatal("TryAcquire(10) after releasing everything = false")
+	}
+}
+
+func TestFIFO(t *testing.T) {
+	s := New(10)
+	ctx := context.Background()
+	s.Acquire(ctx, 10)
+
+	// Each waiter needs the whole semaphore, so they can only be served
+	// one at a time, in the order they arrived
+	var waiters []<-chan error
+	for i := 0; i < 3; i++ {
+		waiters = append(waiters, acquireAsync(ctx, s, 10))
+		waitQueued(t, s, i+1)
+	}
+
+	for i, done := range waiters {
+		s.Release(10)
+		assertAcquired(t, done, fmt.Sprintf("Acquire of waiter %d", i))
+		for _, later := range waiters[i+1:] {
+			assertBlocked(t, later, "a later waiter")
+		}
+	}
+}
+
+func TestNoOvertaking(t *testing.T) {
+	s := New(10)
+	ctx := context.Background()
+	s.Acquire(ctx, 6)
+
+	big := acquireAsync(ctx, s, 8)
+	waitQueued(t, s, 1)
+	small := acquireAsync(ctx, s, 1)
+	waitQueued(t, s, 2)
+
+	// 4 units are free, enough for small but not for big ahead of it
+	assertBlocked(t, small, "Acquire(1) behind Acquire(8)")
+	if s.TryAcquire(1) {
+		t.Error("TryAcquire(1) jumped the queue")
+	}
+
+	s.Release(3)
+	assertBlocked(t, big, "Acquire(8) with 7 units free")
+	assertBlocked(t, small, "Acquire(1) behind Acquire(8)")
+
+	s.Release(3)
+	assertAcquired(t, big, "Acquire(8)")
+	assertAcquired(t, small, "Acquire(1)")
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	s := New(10)
+	s.Acquire(context.Background(), 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	big := acquireAsync(ctx, s, 8)
+	waitQueued(t, s, 1)
+	small := acquireAsync(context.Background(), s, 2)
+	waitQueued(t, s, 2)
+	assertBlocked(t, small, "Acquire(2) behind Acquire(8)")
+
+	// Giving up removes the head of the queue, and the waiter behind it
+	// fits now
+	cancel()
+	if err := <-big; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Acquire(8) = %v, want context.Canceled", err)
+	}
+	assertAcquired(t, small, "Acquire(2)")
+	waitQueued(t, s, 0)
+
+	// Nothing of the cancelled request is held: 5 + 2 taken, 3 free
+	if !s.TryAcquire(3) || s.TryAcquire(1) {
+		t.Error("units held after the cancelled Acquire, want exactly 7 before TryAcquire(3)")
+	}
+}
+
+func TestAcquireCancelledBeforehand(t *testing.T) {
+	s := New(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Acquire(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire with a cancelled ctx = %v, want context.Canceled", err)
+	}
+	if !s.TryAcquire(1) {
+		t.Error("unit held after a failed Acquire")
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	s := New(10)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, 11); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Acquire(11) = %v, want ErrTooLarge", err)
+	}
+	if err := s.Acquire(ctx, -1); !errors.Is(err, ErrNegative) {
+		t.Errorf("Acquire(-1) = %v, want ErrNegative", err)
+	}
+	if s.TryAcquire(-1) {
+		t.Error("TryAcquire(-1) = true")
+	}
+
+	for _, n := range []int64{-1, 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Release(%d) on an empty semaphore did not panic", n)
+				}
+			}()
+			s.Release(n)
+		}()
+	}
+
+	// The failed calls left the semaphore untouched
+	if !s.TryAcquire(10) {
+		t.Error("TryAcquire(10) = false after the invalid calls")
+	}
+}
+
+// ===== BENCHMARKS =====
+// The cost of acquiring and releasing one unit, alone and with 4 units
+// shared by GOMAXPROCS goroutines:
+//
+//	go test -bench . ./internal/semaphore
+
+func BenchmarkWeighted(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("uncontended", func(b *testing.B) {
+		s := New(1)
+		for i := 0; i < b.N; i++ {
+			s.Acquire(ctx, 1)
+			s.Release(1)
+		}
+	})
+	b.Run("contended", func(b *testing.B) {
+		s := New(4)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				s.Acquire(ctx, 1)
+				s.Release(1)
+			}
+		})
+	})
+}
+
+func BenchmarkChannel(b *testing.B) {
+	b.Run("uncontended", func(b *testing.B) {
+		sem := make(chan struct{}, 1)
+		for i := 0; i < b.N; i++ {
+			sem <- struct{}{}
+			<-sem
+		}
+	})
+	b.Run("contended", func(b *testing.B) {
+		sem := make(chan struct{}, 4)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				sem <- struct{}{}
+				<-sem
+			}
+		})
+	})
+}
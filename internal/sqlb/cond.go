@@ -0,0 +1,164 @@
+package sqlb
+
+// Cond is a WHERE condition. Conditions are built with the functions below
+// and combined with And, Or and Not.
+type Cond interface {
+	build(b *builder)
+}
+
+type compare struct {
+	column string
+	op     string
+	value  any
+}
+
+func (c compare) build(b *builder) {
+	b.ident(c.column)
+	b.write(" ", c.op, " ")
+	b.arg(c.value)
+}
+
+func Eq(column string, value any) Cond        { return compare{column, "=", value} }
+func Ne(column string, value any) Cond        { return compare{column, "<>", value} }
+func Gt(column string, value any) Cond        { return compare{column, ">", value} }
+func Ge(column string, value any) Cond        { return compare{column, ">=", value} }
+func Lt(column string, value any) Cond        { return compare{column, "<", value} }
+func Le(column string, value any) Cond        { return compare{column, "<=", value} }
+func Like(column string, pattern string) Cond { return compare{column, "LIKE", pattern} }
+
+type in struct {
+	column string
+	values []any
+}
+
+// In matches rows whose column equals one of values. With no values it
+// matches nothing.
+func In(column string, values ...any) Cond {
+	return in{column, values}
+}
+
+func (c in) build(b *builder) {
+	if len(c.values) == 0 {
+		// Not "IN (NULL)": that is NULL rather than false, so Not(In(col))
+		// would match nothing instead of everything
+		if err := checkIdent(c.column); err != nil && b.err == nil {
+			b.err = err // Still validate the name
+		}
+		b.write("1 = 0")
+		return
+	}
+	b.ident(c.column)
+	b.write(" IN (")
+	for i, v := range c.values {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.arg(v)
+	}
+	b.write(")")
+}
+
+type isNull struct {
+	column string
+	not    bool
+}
+
+func IsNull(column string) Cond    { return isNull{column, false} }
+func IsNotNull(column string) Cond { return isNull{column, true} }
+
+func (c isNull) build(b *builder) {
+	b.ident(c.column)
+	if c.not {
+		b.write(" IS NOT NULL")
+	} else {
+		b.write(" IS NULL")
+	}
+}
+
+type group struct {
+	op    string
+	conds []Cond
+}
+
+// And matches rows satisfying every condition. An And of no conditions
+// adds nothing to a WHERE clause: Where(And(filters...)) with no filters
+// builds no WHERE at all, so UPDATE and DELETE still fail with ErrNoWhere.
+func And(conds ...Cond) Cond { return group{"AND", conds} }
+
+// Or matches rows satisfying at least one condition.
+func Or(conds ...Cond) Cond { return group{"OR", conds} }
+
+func (g group) build(b *builder) {
+	conds := g.conds
+	if g.op == "AND" {
+		conds = nonEmpty(conds)
+	}
+
+	switch len(conds) {
+	case 0:
+		// Empty AND is true, empty OR is false
+		if g.op == "AND" {
+			b.write("1 = 1")
+		} else {
+			b.write("1 = 0")
+		}
+		return
+	case 1:
+		conds[0].build(b)
+		return
+	}
+
+	for i, c := range conds {
+		if i > 0 {
+			b.write(" ", g.op, " ")
+		}
+		_, nested := c.(group)
+		if nested {
+			b.write("(")
+		}
+		c.build(b)
+		if nested {
+			b.write(")")
+		}
+	}
+}
+
+// isEmpty reports whether c is an And of no conditions, or only of such
+// Ands
+func isEmpty(c Cond) bool {
+	g, ok := c.(group)
+	if !ok || g.op != "AND" {
+		return false
+	}
+	for _, c := range g.conds {
+		if !isEmpty(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonEmpty returns conds without the empty Ands, which add nothing to a
+// WHERE clause
+func nonEmpty(conds []Cond) []Cond {
+	var kept []Cond
+	for _, c := range conds {
+		if !isEmpty(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+type not struct {
+	cond Cond
+}
+
+// Not negates a condition.
+func Not(c Cond) Cond { return not{c} }
+
+func (n not) build(b *builder) {
+	b.write("NOT (")
+	n.cond.build(b)
+	b.write(")")
+}
@@ -0,0 +1,339 @@
+// Package sqlb builds parameterized SQL statements.
+//
+//	query, args, err := sqlb.Select("name", "age").
+//		From("users").
+//		Where(sqlb.Gt("age", 30)).
+//		OrderBy("name").
+//		Limit(10).
+//		Build()
+//	// SELECT name, age FROM users WHERE age > ? ORDER BY name LIMIT ?
+//	// args: [30 10]
+//
+// Values are only ever passed as placeholder arguments; there is no way to
+// splice a value into the SQL text. Table and column names are checked
+// against a strict identifier pattern, so they cannot smuggle SQL in either.
+// UPDATE and DELETE statements without Where, or whose conditions are all
+// empty Ands, fail with ErrNoWhere unless AllRows is called, so a forgotten
+// or empty filter cannot wipe a table.
+package sqlb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidIdentifier = errors.New("sqlb: invalid identifier")
+
+	// ErrNoWhere is returned when building an UPDATE or DELETE without
+	// conditions; call AllRows to really change every row.
+	ErrNoWhere = errors.New("sqlb: update or delete without Where")
+)
+
+// identRE accepts plain names and table-qualified names like users.email
+var identRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func checkIdent(name string) error {
+	if !identRE.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidIdentifier, name)
+	}
+	return nil
+}
+
+// builder collects SQL text, arguments and the first error
+type builder struct {
+	sql  strings.Builder
+	args []any
+	err  error
+}
+
+func (b *builder) write(parts ...string) {
+	for _, p := range parts {
+		b.sql.WriteString(p)
+	}
+}
+
+func (b *builder) ident(name string) {
+	if err := checkIdent(name); err != nil && b.err == nil {
+		b.err = err
+	}
+	b.sql.WriteString(name)
+}
+
+func (b *builder) idents(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(name)
+	}
+}
+
+func (b *builder) arg(v any) {
+	b.sql.WriteString("?")
+	b.args = append(b.args, v)
+}
+
+func (b *builder) where(conds []Cond) {
+	if len(conds) == 0 {
+		return
+	}
+	b.write(" WHERE ")
+	And(conds...).build(b)
+}
+
+func (b *builder) result() (string, []any, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	return b.sql.String(), b.args, nil
+}
+
+// ===== SELECT =====
+
+type SelectBuilder struct {
+	columns []string
+	table   string
+	where   []Cond
+	orderBy []string
+	limit   *int
+	offset  *int
+}
+
+// Select starts a SELECT of the given columns, or of * if none are given.
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+func (s *SelectBuilder) From(table string) *SelectBuilder {
+	s.table = table
+	return s
+}
+
+// Where adds conditions; multiple calls and arguments are ANDed together.
+func (s *SelectBuilder) Where(conds ...Cond) *SelectBuilder {
+	s.where = append(s.where, nonEmpty(conds)...)
+	return s
+}
+
+// OrderBy adds sort keys: a column name optionally followed by ASC or DESC.
+func (s *SelectBuilder) OrderBy(keys ...string) *SelectBuilder {
+	s.orderBy = append(s.orderBy, keys...)
+	return s
+}
+
+func (s *SelectBuilder) Limit(n int) *SelectBuilder {
+	s.limit = &n
+	return s
+}
+
+func (s *SelectBuilder) Offset(n int) *SelectBuilder {
+	s.offset = &n
+	return s
+}
+
+func (s *SelectBuilder) Build() (string, []any, error) {
+	var b builder
+
+	b.write("SELECT ")
+	if len(s.columns) == 0 {
+		b.write("*")
+	} else {
+		b.idents(s.columns)
+	}
+
+	b.write(" FROM ")
+	b.ident(s.table)
+	b.where(s.where)
+
+	if len(s.orderBy) > 0 {
+		b.write(" ORDER BY ")
+		for i, key := range s.orderBy {
+			if i > 0 {
+				b.write(", ")
+			}
+			col, dir, _ := strings.Cut(key, " ")
+			b.ident(col)
+			switch strings.ToUpper(strings.TrimSpace(dir)) {
+			case "":
+			case "ASC":
+				b.write(" ASC")
+			case "DESC":
+				b.write(" DESC")
+			default:
+				if b.err == nil {
+					b.err = fmt.Errorf("sqlb: invalid sort direction in %q", key)
+				}
+			}
+		}
+	}
+
+	if s.limit != nil {
+		b.write(" LIMIT ")
+		b.arg(*s.limit)
+	}
+	if s.offset != nil {
+		if s.limit == nil {
+			b.write(" LIMIT -1") // SQLite requires LIMIT before OFFSET
+		}
+		b.write(" OFFSET ")
+		b.arg(*s.offset)
+	}
+
+	return b.result()
+}
+
+// ===== INSERT =====
+
+type InsertBuilder struct {
+	table   string
+	columns []string
+	rows    [][]any
+}
+
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+func (i *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	i.columns = columns
+	return i
+}
+
+// Values adds one row; call it repeatedly for a multi-row insert.
+func (i *InsertBuilder) Values(values ...any) *InsertBuilder {
+	i.rows = append(i.rows, values)
+	return i
+}
+
+func (i *InsertBuilder) Build() (string, []any, error) {
+	var b builder
+
+	if len(i.columns) == 0 || len(i.rows) == 0 {
+		return "", nil, errors.New("sqlb: insert needs columns and at least one row of values")
+	}
+
+	b.write("INSERT INTO ")
+	b.ident(i.table)
+	b.write(" (")
+	b.idents(i.columns)
+	b.write(") VALUES ")
+
+	for r, row := range i.rows {
+		if len(row) != len(i.columns) {
+			return "", nil, fmt.Errorf("sqlb: insert row %d has %d values for %d columns", r, len(row), len(i.columns))
+		}
+		if r > 0 {
+			b.write(", ")
+		}
+		b.write("(")
+		for c, v := range row {
+			if c > 0 {
+				b.write(", ")
+			}
+			b.arg(v)
+		}
+		b.write(")")
+	}
+
+	return b.result()
+}
+
+// ===== UPDATE =====
+
+type UpdateBuilder struct {
+	table   string
+	sets    []string
+	values  []any
+	where   []Cond
+	allRows bool
+}
+
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set assigns value to column; calls accumulate in order.
+func (u *UpdateBuilder) Set(column string, value any) *UpdateBuilder {
+	u.sets = append(u.sets, column)
+	u.values = append(u.values, value)
+	return u
+}
+
+func (u *UpdateBuilder) Where(conds ...Cond) *UpdateBuilder {
+	u.where = append(u.where, nonEmpty(conds)...)
+	return u
+}
+
+// AllRows allows building the statement without Where, updating every row
+// of the table.
+func (u *UpdateBuilder) AllRows() *UpdateBuilder {
+	u.allRows = true
+	return u
+}
+
+func (u *UpdateBuilder) Build() (string, []any, error) {
+	var b builder
+
+	if len(u.sets) == 0 {
+		return "", nil, errors.New("sqlb: update needs at least one Set")
+	}
+	if len(u.where) == 0 && !u.allRows {
+		return "", nil, ErrNoWhere
+	}
+
+	b.write("UPDATE ")
+	b.ident(u.table)
+	b.write(" SET ")
+	for i, col := range u.sets {
+		if i > 0 {
+			b.write(", ")
+		}
+		b.ident(col)
+		b.write(" = ")
+		b.arg(u.values[i])
+	}
+	b.where(u.where)
+
+	return b.result()
+}
+
+// ===== DELETE =====
+
+type DeleteBuilder struct {
+	table   string
+	where   []Cond
+	allRows bool
+}
+
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+func (d *DeleteBuilder) Where(conds ...Cond) *DeleteBuilder {
+	d.where = append(d.where, nonEmpty(conds)...)
+	return d
+}
+
+// AllRows allows building the statement without Where, deleting every row
+// of the table.
+func (d *DeleteBuilder) AllRows() *DeleteBuilder {
+	d.allRows = true
+	return d
+}
+
+func (d *DeleteBuilder) Build() (string, []any, error) {
+	var b builder
+
+	if len(d.where) == 0 && !d.allRows {
+		return "", nil, ErrNoWhere
+	}
+
+	b.write("DELETE FROM ")
+	b.ident(d.table)
+	b.where(d.where)
+
+	return b.result()
+}
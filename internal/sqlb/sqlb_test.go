@@ -0,0 +1,149 @@
+package sqlb_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go_lang_tutorial/internal/sqlb"
+)
+
+type statement interface {
+	Build() (string, []any, error)
+}
+
+func TestBuild(t *testing.T) {
+	var noFilters []sqlb.Cond
+
+	tests := []struct {
+		name  string
+		stmt  statement
+		query string
+		args  []any
+	}{
+		{
+			"select",
+			sqlb.Select("name", "age").From("users").
+				Where(sqlb.Gt("age", 30), sqlb.Like("name", "A%")).
+				OrderBy("name", "age DESC").Limit(10).Offset(20),
+			"SELECT name, age FROM users WHERE age > ? AND name LIKE ? ORDER BY name, age DESC LIMIT ? OFFSET ?",
+			[]any{30, "A%", 10, 20},
+		},
+		{
+			"select star with offset only",
+			sqlb.Select().From("users").Offset(5),
+			"SELECT * FROM users LIMIT -1 OFFSET ?",
+			[]any{5},
+		},
+		{
+			"nested groups",
+			sqlb.Select("id").From("users").Where(sqlb.Or(
+				sqlb.And(sqlb.Eq("role", "admin"), sqlb.IsNull("deleted_at")),
+				sqlb.Not(sqlb.In("id", 1, 2)),
+			)),
+			"SELECT id FROM users WHERE (role = ? AND deleted_at IS NULL) OR NOT (id IN (?, ?))",
+			[]any{"admin", 1, 2},
+		},
+		{
+			"empty in",
+			sqlb.Select("id").From("users").Where(sqlb.In("id")),
+			"SELECT id FROM users WHERE 1 = 0",
+			nil,
+		},
+		{
+			"empty and adds no condition",
+			sqlb.Select("id").From("users").Where(sqlb.And(noFilters...)),
+			"SELECT id FROM users",
+			nil,
+		},
+		{
+			"empty and inside and",
+			sqlb.Select("id").From("users").Where(sqlb.And(sqlb.And(), sqlb.Eq("id", 7))),
+			"SELECT id FROM users WHERE id = ?",
+			[]any{7},
+		},
+		{
+			"empty or matches nothing",
+			sqlb.Select("id").From("users").Where(sqlb.Or(noFilters...)),
+			"SELECT id FROM users WHERE 1 = 0",
+			nil,
+		},
+		{
+			"insert",
+			sqlb.Insert("users").Columns("name", "age").Values("Alice", 30).Values("Bob", 25),
+			"INSERT INTO users (name, age) VALUES (?, ?), (?, ?)",
+			[]any{"Alice", 30, "Bob", 25},
+		},
+		{
+			"update",
+			sqlb.Update("users").Set("name", "Carol").Set("age", 41).Where(sqlb.Eq("id", 3)),
+			"UPDATE users SET name = ?, age = ? WHERE id = ?",
+			[]any{"Carol", 41, 3},
+		},
+		{
+			"update all rows",
+			sqlb.Update("users").Set("active", false).AllRows(),
+			"UPDATE users SET active = ?",
+			[]any{false},
+		},
+		{
+			"delete",
+			sqlb.Delete("users").Where(sqlb.Lt("users.age", 18)),
+			"DELETE FROM users WHERE users.age < ?",
+			[]any{18},
+		},
+		{
+			"delete with empty or",
+			sqlb.Delete("users").Where(sqlb.Or()),
+			"DELETE FROM users WHERE 1 = 0",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tt.stmt.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.query {
+				t.Errorf("query = %q\nwant    %q", query, tt.query)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	var noFilters []sqlb.Cond
+
+	tests := []struct {
+		name string
+		stmt statement
+		want error
+	}{
+		{"update without where", sqlb.Update("users").Set("name", "x"), sqlb.ErrNoWhere},
+		{"delete without where", sqlb.Delete("users"), sqlb.ErrNoWhere},
+		{"update with empty and", sqlb.Update("users").Set("name", "x").Where(sqlb.And(noFilters...)), sqlb.ErrNoWhere},
+		{"delete with empty and", sqlb.Delete("users").Where(sqlb.And(noFilters...)), sqlb.ErrNoWhere},
+		{"delete with nested empty ands", sqlb.Delete("users").Where(sqlb.And(sqlb.And()), sqlb.And()), sqlb.ErrNoWhere},
+		{"table name", sqlb.Select().From("users; DROP TABLE users"), sqlb.ErrInvalidIdentifier},
+		{"column name", sqlb.Select("name").From("users").Where(sqlb.Eq("1=1 OR name", "x")), sqlb.ErrInvalidIdentifier},
+		{"empty in column", sqlb.Delete("users").Where(sqlb.In("id)")), sqlb.ErrInvalidIdentifier},
+		{"sort direction", sqlb.Select().From("users").OrderBy("name SIDEWAYS"), nil},
+		{"update without set", sqlb.Update("users").AllRows(), nil},
+		{"insert row length", sqlb.Insert("users").Columns("name", "age").Values("Alice"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _, err := tt.stmt.Build()
+			if err == nil {
+				t.Fatalf("Build() = %q, want an error", query)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Build() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+// Package sqllog wraps a database/sql driver to log every statement with
+// its duration, row count and (redacted) arguments, and to flag slow ones.
+//
+// Because it wraps the driver rather than *sql.DB, everything built on
+// database/sql is covered unchanged: transactions, prepared statements,
+// the repositories and the migrator. A typical line:
+//
+//	sql: [req 3f9a1c2e8b7d6054] exec 1.2ms rows=1: UPDATE users SET age = ? WHERE id = ? ['***' 31]
+//
+// The request ID comes from the context (see internal/requestid), so it is
+// only present for statements run with the request's context.
+package sqllog
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"go_lang_tutorial/internal/requestid"
+)
+
+// Options controls what is logged and where.
+type Options struct {
+	Logger *log.Logger // Defaults to log.Default()
+
+	// Statements taking at least SlowThreshold are marked SLOW; zero
+	// disables the check. With SlowOnly, only those are logged.
+	SlowThreshold time.Duration
+	SlowOnly      bool
+
+	// Redact formats one argument for the log. Defaults to RedactArg.
+	Redact func(v driver.Value) string
+
+	// MaxQueryLen truncates long statements (e.g. migrations) in the log.
+	// Defaults to 200 bytes; negative disables truncation.
+	MaxQueryLen int
+}
+
+// RedactArg is the default argument formatter. Numbers, booleans, times and
+// NULL are shown as-is; text and blobs can hold personal data and are hidden.
+func RedactArg(v driver.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64, float64, bool:
+		return fmt.Sprint(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case string:
+		return "'***'"
+	case []byte:
+		return fmt.Sprintf("<%d bytes>", len(v))
+	default:
+		return "?"
+	}
+}
+
+// Wrap returns a driver that logs every statement run through d.
+func Wrap(d driver.Driver, opts Options) driver.Driver {
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+	if opts.Redact == nil {
+		opts.Redact = RedactArg
+	}
+	if opts.MaxQueryLen == 0 {
+		opts.MaxQueryLen = 200
+	}
+	return &loggingDriver{Driver: d, opts: opts}
+}
+
+// NewConnector returns a connector for sql.OpenDB that opens dsn with d and
+// logs every statement:
+//
+//	db := sql.OpenDB(sqllog.NewConnector(&sqlite3.SQLiteDriver{}, "app.db", sqllog.Options{}))
+func NewConnector(d driver.Driver, dsn string, opts Options) driver.Connector {
+	return &connector{driver: Wrap(d, opts).(*loggingDriver), dsn: dsn}
+}
+
+type loggingDriver struct {
+	driver.Driver
+	opts Options
+}
+
+func (d *loggingDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, opts: &d.opts}, nil
+}
+
+type connector struct {
+	driver *loggingDriver
+	dsn    string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *connector) Driver() driver.Driver { return c.driver }
+
+// ===== LOGGING =====
+
+func (o *Options) log(ctx context.Context, kind, query string, args []driver.NamedValue, start time.Time, rows int64, err error) {
+	elapsed := time.Since(start)
+	slow := o.SlowThreshold > 0 && elapsed >= o.SlowThreshold
+	if o.SlowOnly && !slow {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("sql: ")
+	if slow {
+		b.WriteString("SLOW ")
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		fmt.Fprintf(&b, "[req %s] ", id)
+	}
+	fmt.Fprintf(&b, "%s %v", kind, elapsed.Round(time.Microsecond))
+	if rows >= 0 {
+		fmt.Fprintf(&b, " rows=%d", rows)
+	}
+	b.WriteString(": ")
+	b.WriteString(o.formatQuery(query))
+
+	if len(args) > 0 {
+		b.WriteString(" [")
+		for i, a := range args {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(o.Redact(a.Value))
+		}
+		b.WriteByte(']')
+	}
+	if err != nil {
+		fmt.Fprintf(&b, " error=%q", err.Error())
+	}
+
+	o.Logger.Print(b.String())
+}
+
+// formatQuery puts a statement on one line and shortens it if needed
+func (o *Options) formatQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if o.MaxQueryLen > 0 && len(query) > o.MaxQueryLen {
+		query = query[:o.MaxQueryLen] + "…"
+	}
+	return query
+}
+
+// ===== CONNECTIONS =====
+
+type conn struct {
+	driver.Conn
+	opts *Options
+}
+
+// Unwrap returns the driver's own connection, e.g. for *sql.Conn.Raw
+// callers that need driver-specific APIs.
+func (c *conn) Unwrap() driver.Conn { return c.Conn }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, query: query, opts: c.opts}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() // Drivers without context support
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip // database/sql falls back to Prepare
+	}
+
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	c.opts.log(ctx, "exec", query, args, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	r, err := q.QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	if err != nil {
+		c.opts.log(ctx, "query", query, args, start, -1, err)
+		return nil, err
+	}
+	return &rows{Rows: r, ctx: ctx, query: query, args: args, start: start, opts: c.opts}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip // Use the default conversion
+}
+
+func rowsAffected(res driver.Result, err error) int64 {
+	if err != nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// ===== PREPARED STATEMENTS =====
+
+type stmt struct {
+	driver.Stmt
+	query string
+	opts  *Options
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(values(args)) // Drivers without context support
+	}
+
+	s.opts.log(ctx, "exec", s.query, args, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+
+	var (
+		r   driver.Rows
+		err error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		r, err = q.QueryContext(ctx, args)
+	} else {
+		r, err = s.Stmt.Query(values(args)) // Drivers without context support
+	}
+
+	if err != nil {
+		s.opts.log(ctx, "query", s.query, args, start, -1, err)
+		return nil, err
+	}
+	return &rows{Rows: r, ctx: ctx, query: s.query, args: args, start: start, opts: s.opts}, nil
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(args))
+	for i, a := range args {
+		vals[i] = a.Value
+	}
+	return vals
+}
+
+// ===== ROWS =====
+// A query is logged when its rows are closed, so the line shows how many
+// rows were read and how long the caller held the result set open.
+
+type rows struct {
+	driver.Rows
+	ctx   context.Context
+	query string
+	args  []driver.NamedValue
+	start time.Time
+	opts  *Options
+
+	n   int64
+	err error
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == nil:
+		r.n++
+	case err != io.EOF:
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.opts.log(r.ctx, "query", r.query, r.args, r.start, r.n, r.err)
+	return err
+}
+
+// Column type information is passed through from the driver's rows, so
+// *sql.Rows.ColumnTypes works as without the wrapper.
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if t, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return t.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if t, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return t.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return t.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return t.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if t, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return t.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,155 @@
+// Package sqlscan scans *sql.Rows into structs, matching result columns to
+// fields by their `db:"column"` tag (or the lower-cased field name when the
+// tag is missing). Fields tagged `db:"-"` are ignored and untagged embedded
+// structs are flattened.
+//
+// Field addresses are handed to rows.Scan directly, so anything database/sql
+// can scan into works as a field type: sql.NullString and friends, other
+// sql.Scanner implementations, and pointers such as *string, which are left
+// nil for NULL columns.
+//
+// The column-to-field mapping ("plan") is computed once per struct type and
+// column list and cached.
+package sqlscan
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ScanAll reads every remaining row into a T and closes rows. With no rows
+// it returns an empty slice rather than nil, which encodes as [] in JSON.
+func ScanAll[T any](rows *sql.Rows) ([]T, error) {
+	defer rows.Close()
+
+	p, err := planFor[T](rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []T{}
+	dest := make([]any, len(p.fields))
+	for rows.Next() {
+		var item T
+		p.bind(reflect.ValueOf(&item).Elem(), dest)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("sqlscan: %w", err)
+		}
+		out = append(out, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlscan: %w", err)
+	}
+	return out, nil
+}
+
+// ScanOne reads the first row into a T and closes rows. It returns
+// sql.ErrNoRows if there is no row.
+func ScanOne[T any](rows *sql.Rows) (T, error) {
+	defer rows.Close()
+
+	var item T
+	p, err := planFor[T](rows)
+	if err != nil {
+		return item, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return item, fmt.Errorf("sqlscan: %w", err)
+		}
+		return item, sql.ErrNoRows
+	}
+
+	dest := make([]any, len(p.fields))
+	p.bind(reflect.ValueOf(&item).Elem(), dest)
+	if err := rows.Scan(dest...); err != nil {
+		return item, fmt.Errorf("sqlscan: %w", err)
+	}
+	return item, rows.Close()
+}
+
+// ===== PLANS =====
+
+// plan holds, for each result column, the index path of the struct field
+// it is scanned into.
+type plan struct {
+	fields [][]int
+}
+
+func (p *plan) bind(v reflect.Value, dest []any) {
+	for i, index := range p.fields {
+		dest[i] = v.FieldByIndex(index).Addr().Interface()
+	}
+}
+
+type planKey struct {
+	typ     reflect.Type
+	columns string
+}
+
+var plans sync.Map // planKey -> *plan
+
+func planFor[T any](rows *sql.Rows) (*plan, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("sqlscan: %w", err)
+	}
+
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	key := planKey{typ: typ, columns: strings.Join(columns, ",")}
+	if p, ok := plans.Load(key); ok {
+		return p.(*plan), nil
+	}
+
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sqlscan: %s is not a struct", typ)
+	}
+
+	byColumn := make(map[string][]int)
+	collectFields(typ, nil, byColumn)
+
+	p := &plan{fields: make([][]int, len(columns))}
+	for i, col := range columns {
+		index, ok := byColumn[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("sqlscan: column %q has no matching field in %s", col, typ)
+		}
+		p.fields[i] = index
+	}
+
+	plans.Store(key, p)
+	return p, nil
+}
+
+func collectFields(typ reflect.Type, parent []int, byColumn map[string][]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, hasTag := f.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+
+		index := append(append([]int(nil), parent...), i)
+
+		if f.Anonymous && !hasTag && f.Type.Kind() == reflect.Struct {
+			collectFields(f.Type, index, byColumn)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		name := strings.ToLower(f.Name)
+		if tag != "" {
+			name = strings.ToLower(tag)
+		}
+		// Shallower fields win over ones promoted from embedded structs
+		if _, exists := byColumn[name]; !exists || len(index) < len(byColumn[name]) {
+			byColumn[name] = index
+		}
+	}
+}
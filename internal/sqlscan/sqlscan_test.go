@@ -0,0 +1,145 @@
+package sqlscan
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type base struct {
+	ID int64
+}
+
+type user struct {
+	base
+	Name    string
+	Email   *string `db:"email_address"`
+	Secret  string  `db:"-"`
+	private string
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email_address TEXT, secret TEXT);
+		INSERT INTO users (id, name, email_address, secret) VALUES
+			(1, 'Alice', 'alice@example.com', 'x'),
+			(2, 'Bob', NULL, 'y');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func query(t *testing.T, db *sql.DB, q string) *sql.Rows {
+	t.Helper()
+	rows, err := db.Query(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestScanAll(t *testing.T) {
+	db := openDB(t)
+
+	users, err := ScanAll[user](query(t, db, "SELECT id, name, email_address FROM users ORDER BY id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := "alice@example.com"
+	want := []user{
+		{base: base{ID: 1}, Name: "Alice", Email: &email},
+		{base: base{ID: 2}, Name: "Bob"},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("ScanAll = %+v, want %+v", users, want)
+	}
+
+	none, err := ScanAll[user](query(t, db, "SELECT id, name FROM users WHERE id < 0"))
+	if err != nil || none == nil || len(none) != 0 {
+		t.Errorf("ScanAll with no rows = %#v, %v, want an empty non-nil slice", none, err)
+	}
+}
+
+func TestScanOne(t *testing.T) {
+	db := openDB(t)
+
+	u, err := ScanOne[user](query(t, db, "SELECT name, id FROM users WHERE id = 2"))
+	if err != nil || u.ID != 2 || u.Name != "Bob" || u.Email != nil {
+		t.Errorf("ScanOne = %+v, %v, want Bob with a nil Email", u, err)
+	}
+
+	if _, err := ScanOne[user](query(t, db, "SELECT id FROM users WHERE id < 0")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ScanOne with no rows = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestColumnMismatch(t *testing.T) {
+	db := openDB(t)
+
+	tests := []struct {
+		query, column string
+	}{
+		{"SELECT id, secret FROM users", "secret"}, // tagged db:"-"
+		{"SELECT id, private FROM (SELECT 1 AS id, 'p' AS private)", "private"},
+		{"SELECT id, email FROM (SELECT 1 AS id, 'e' AS email)", "email"}, // renamed by its tag
+	}
+	for _, tt := range tests {
+		_, err := ScanAll[user](query(t, db, tt.query))
+		if err == nil || !strings.Contains(err.Error(), `column "`+tt.column+`"`) {
+			t.Errorf("ScanAll(%q) = %v, want an error naming column %q", tt.query, err, tt.column)
+		}
+	}
+
+	if _, err := ScanAll[int](query(t, db, "SELECT id FROM users")); err == nil {
+		t.Error("ScanAll[int] succeeded, want an error for a non-struct type")
+	}
+}
+
+func TestPlanCache(t *testing.T) {
+	db := openDB(t)
+	cached := func(columns string) *plan {
+		p, ok := plans.Load(planKey{typ: reflect.TypeOf(user{}), columns: columns})
+		if !ok {
+			return nil
+		}
+		return p.(*plan)
+	}
+
+	if _, err := ScanAll[user](query(t, db, "SELECT name, id FROM users")); err != nil {
+		t.Fatal(err)
+	}
+	first := cached("name,id")
+	if first == nil {
+		t.Fatal("no plan cached for columns name,id")
+	}
+	if want := [][]int{{1}, {0, 0}}; !reflect.DeepEqual(first.fields, want) {
+		t.Errorf("plan fields = %v, want %v", first.fields, want)
+	}
+
+	// The same columns reuse the plan; another column order gets its own
+	if _, err := ScanOne[user](query(t, db, "SELECT name, id FROM users")); err != nil {
+		t.Fatal(err)
+	}
+	if cached("name,id") != first {
+		t.Error("plan for name,id was rebuilt")
+	}
+	if _, err := ScanOne[user](query(t, db, "SELECT id, name FROM users")); err != nil {
+		t.Fatal(err)
+	}
+	if p := cached("id,name"); p == nil || p == first {
+		t.Errorf("plan for id,name = %p, want a new plan", p)
+	}
+}
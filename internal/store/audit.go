@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go_lang_tutorial/internal/sqlscan"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionAvatar  = "avatar"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// DefaultActor is recorded for changes made with a context that carries no
+// actor, e.g. from command-line tools.
+const DefaultActor = "system"
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes are attributed to actor in the
+// audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored by WithActor, or DefaultActor.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return DefaultActor
+}
+
+// AuditEntry is one change to a user. User holds the user as it was after
+// the change (for deletes: as it was when deleted).
+type AuditEntry struct {
+	ID     int64     `db:"id" json:"id"`
+	UserID int64     `db:"user_id" json:"user_id"`
+	Action string    `db:"action" json:"action"`
+	Actor  string    `db:"actor" json:"actor"`
+	At     time.Time `db:"created_at" json:"at"`
+	User   User      `db:"-" json:"user"`
+}
+
+// auditRow is an audit_log row before its data column is decoded
+type auditRow struct {
+	AuditEntry
+	Data string `db:"data"`
+}
+
+const auditColumns = "id, user_id, action, actor, data, created_at"
+
+// audit records action on u, attributed to the actor in ctx. It must run in
+// the same transaction as the change itself.
+func audit(ctx context.Context, tx *sql.Tx, action string, u User) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO audit_log (user_id, action, actor, data, created_at) VALUES (?, ?, ?, ?, ?)",
+		u.ID, action, ActorFrom(ctx), string(data), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// History returns every recorded change to the user with the given ID,
+// oldest first. Deleted users keep their history. It returns ErrNotFound if
+// the user never existed.
+func (r *UserRepository) History(ctx context.Context, id int64) ([]AuditEntry, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+auditColumns+" FROM audit_log WHERE user_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, fmt.Errorf("history of user %d: %w", id, err)
+	}
+
+	auditRows, err := sqlscan.ScanAll[auditRow](rows)
+	if err != nil {
+		return nil, fmt.Errorf("history of user %d: %w", id, err)
+	}
+
+	// Users created before the audit log existed have no entries yet
+	if len(auditRows) == 0 {
+		var exists bool
+		err := r.db.QueryRowContext(ctx, "SELECT 1 FROM users WHERE id = ?", id).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("history of user %d: %w", id, mapError(err))
+		}
+	}
+
+	entries := make([]AuditEntry, len(auditRows))
+	for i, row := range auditRows {
+		entries[i] = row.AuditEntry
+		if err := json.Unmarshal([]byte(row.Data), &entries[i].User); err != nil {
+			return nil, fmt.Errorf("history of user %d: entry %d: %w", id, row.ID, err)
+		}
+	}
+	return entries, nil
+}
+
+// Restore undeletes the user with the given ID. If entryID is not zero, the
+// user's fields are also reset to how they were recorded in that audit log
+// entry. It returns ErrNotFound if the user or entry does not exist, and
+// ErrDuplicateEmail if an active user has taken the email in the meantime.
+func (r *UserRepository) Restore(ctx context.Context, id, entryID int64) (User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var restored User
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		u, err := queryOne(ctx, tx, "SELECT "+userColumns+" FROM users WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		version := u.Version
+		if entryID != 0 {
+			rows, err := tx.QueryContext(ctx,
+				"SELECT "+auditColumns+" FROM audit_log WHERE id = ? AND user_id = ?", entryID, id)
+			if err != nil {
+				return err
+			}
+			row, err := sqlscan.ScanOne[auditRow](rows)
+			if err != nil {
+				return fmt.Errorf("audit entry %d: %w", entryID, mapError(err))
+			}
+			u = User{}
+			if err := json.Unmarshal([]byte(row.Data), &u); err != nil {
+				return fmt.Errorf("audit entry %d: %w", entryID, err)
+			}
+			u.ID = id
+		}
+		u.Version = version + 1
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET name = ?, email = ?, age = ?, avatar = ?, version = ?, deleted_at = NULL WHERE id = ?",
+			u.Name, u.Email, u.Age, u.Avatar, u.Version, id)
+		if err != nil {
+			return mapError(err)
+		}
+
+		restored = u
+		return audit(ctx, tx, ActionRestore, u)
+	})
+	if err != nil {
+		return User{}, fmt.Errorf("restore user %d: %w", id, err)
+	}
+	return restored, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// RowError reports why one row of a bulk insert was rejected.
+type RowError struct {
+	Row  int // Index into the slice passed to BulkCreate
+	User User
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d (%s): %v", e.Row, e.User.Email, e.Err)
+}
+
+func (e RowError) Unwrap() error { return e.Err }
+
+// BulkResult summarizes a bulk insert.
+type BulkResult struct {
+	Inserted int
+	Errors   []RowError
+}
+
+// BulkCreate inserts users in one transaction through a single prepared
+// statement, auditing each insert. Once the transaction has committed, the
+// ID and version of every inserted user are set. Rows rejected for domain
+// reasons (ErrInvalidUser, ErrDuplicateEmail) are skipped and reported in
+// the result while the rest are still inserted; any other error aborts the
+// whole batch and nothing is inserted.
+//
+// The per-call query timeout does not apply, since a large import may
+// legitimately take longer; bound it with ctx instead.
+func (r *UserRepository) BulkCreate(ctx context.Context, users []User) (BulkResult, error) {
+	var result BulkResult
+	ids := make([]int64, len(users)) // Zero for rejected rows
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result = BulkResult{} // The transaction may be retried
+		clear(ids)
+
+		stmt, err := tx.PrepareContext(ctx,
+			"INSERT INTO users (name, email, age, avatar) VALUES (?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for i := range users {
+			u := users[i] // A copy: the caller's slice is only updated after commit
+			if err := u.validate(); err != nil {
+				result.Errors = append(result.Errors, RowError{Row: i, User: u, Err: err})
+				continue
+			}
+
+			res, err := stmt.ExecContext(ctx, u.Name, u.Email, u.Age, u.Avatar)
+			if err != nil {
+				// SQLite only undoes the failed statement, so the
+				// transaction can continue after a constraint violation.
+				if err := mapError(err); errors.Is(err, ErrDuplicateEmail) {
+					result.Errors = append(result.Errors, RowError{Row: i, User: u, Err: err})
+					continue
+				}
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+
+			if u.ID, err = res.LastInsertId(); err != nil {
+				return err
+			}
+			u.Version = 1
+			if err := audit(ctx, tx, ActionCreate, u); err != nil {
+				return err
+			}
+			ids[i] = u.ID
+			result.Inserted++
+		}
+		return nil
+	})
+	if err != nil {
+		return BulkResult{}, fmt.Errorf("bulk create users: %w", err)
+	}
+
+	for i, id := range ids {
+		if id != 0 {
+			users[i].ID, users[i].Version = id, 1
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"go_lang_tutorial/internal/dbtest"
+	"go_lang_tutorial/internal/store"
+)
+
+func TestBulkCreateRollbackLeavesIDsUnset(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+
+	// Fails the batch after the first user has been inserted
+	_, err := db.ExecContext(ctx, `
+		CREATE TRIGGER fail_boom BEFORE INSERT ON users WHEN NEW.email = 'boom@example.com'
+		BEGIN SELECT RAISE(ABORT, 'boom'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []store.User{
+		{Name: "Alice", Email: "alice@example.com", Age: 30},
+		{Name: "Boom", Email: "boom@example.com", Age: 40},
+	}
+	repo := store.NewUserRepository(db)
+	if _, err := repo.BulkCreate(ctx, users); err == nil {
+		t.Fatal("BulkCreate succeeded, want the trigger's error")
+	}
+
+	for i, u := range users {
+		if u.ID != 0 || u.Version != 0 {
+			t.Errorf("users[%d] has ID %d, version %d after rollback, want zero", i, u.ID, u.Version)
+		}
+	}
+	if all, err := repo.List(ctx); err != nil || len(all) != 0 {
+		t.Errorf("List() = %v, %v after rollback, want no users", all, err)
+	}
+}
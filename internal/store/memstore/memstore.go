@@ -0,0 +1,397 @@
+// Package memstore is a pure-Go, in-memory implementation of
+// store.Repository. It needs no database or cgo, which makes it handy for
+// demos and for tests of code that only depends on the interface.
+//
+// It follows the same rules as the SQLite repository (soft delete, audit
+// history, row versions, unique emails among active users), as checked by
+// internal/storetest. Data is lost when the process exits.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go_lang_tutorial/internal/store"
+)
+
+type row struct {
+	user    store.User
+	deleted bool
+}
+
+// Store holds users in memory. The zero value is not usable; call New.
+type Store struct {
+	mu     sync.RWMutex
+	rows   map[int64]*row
+	audit  []store.AuditEntry
+	nextID int64
+}
+
+var _ store.Repository = (*Store)(nil)
+
+func New() *Store {
+	return &Store{rows: make(map[int64]*row), nextID: 1}
+}
+
+// Create inserts u and sets its ID and version.
+func (s *Store) Create(ctx context.Context, u *store.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := store.Validate(*u); err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(u.Email, 0) {
+		return fmt.Errorf("create user: %w", store.ErrDuplicateEmail)
+	}
+	s.insert(ctx, u)
+	return nil
+}
+
+// Get returns the active user with the given ID.
+func (s *Store) Get(ctx context.Context, id int64) (store.User, error) {
+	if err := ctx.Err(); err != nil {
+		return store.User{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.rows[id]
+	if !ok || r.deleted {
+		return store.User{}, fmt.Errorf("get user %d: %w", id, store.ErrNotFound)
+	}
+	return r.user, nil
+}
+
+// FindByEmail returns the active user with the given email.
+func (s *Store) FindByEmail(ctx context.Context, email string) (store.User, error) {
+	if err := ctx.Err(); err != nil {
+		return store.User{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.rows {
+		if !r.deleted && r.user.Email == email {
+			return r.user, nil
+		}
+	}
+	return store.User{}, fmt.Errorf("find user by email: %w", store.ErrNotFound)
+}
+
+// List returns all active users ordered by ID.
+func (s *Store) List(ctx context.Context) ([]store.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []store.User{} // [] rather than null in JSON, as from SQLite
+	for _, r := range s.rows {
+		if !r.deleted {
+			users = append(users, r.user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// Update overwrites the user with u.ID if its version is still u.Version.
+func (s *Store) Update(ctx context.Context, u *store.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := store.Validate(*u); err != nil {
+		return fmt.Errorf("update user %d: %w", u.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rows[u.ID]
+	switch {
+	case !ok || r.deleted:
+		return fmt.Errorf("update user %d: %w", u.ID, store.ErrNotFound)
+	case r.user.Version != u.Version:
+		return fmt.Errorf("update user %d: %w", u.ID, store.ErrConflict)
+	case s.emailTaken(u.Email, u.ID):
+		return fmt.Errorf("update user %d: %w", u.ID, store.ErrDuplicateEmail)
+	}
+
+	u.Version++
+	r.user = *u
+	s.record(ctx, store.ActionUpdate, r.user)
+	return nil
+}
+
+// SetAvatar changes only the avatar of the user with the given ID.
+func (s *Store) SetAvatar(ctx context.Context, id int64, avatar string) (store.User, error) {
+	if err := ctx.Err(); err != nil {
+		return store.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rows[id]
+	if !ok || r.deleted {
+		return store.User{}, fmt.Errorf("set avatar of user %d: %w", id, store.ErrNotFound)
+	}
+
+	r.user.Avatar = avatar
+	r.user.Version++
+	s.record(ctx, store.ActionAvatar, r.user)
+	return r.user, nil
+}
+
+// Delete soft-deletes the user with the given ID.
+func (s *Store) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rows[id]
+	if !ok || r.deleted {
+		return fmt.Errorf("delete user %d: %w", id, store.ErrNotFound)
+	}
+
+	r.deleted = true
+	r.user.Version++
+	s.record(ctx, store.ActionDelete, r.user)
+	return nil
+}
+
+// BulkCreate inserts users, skipping invalid rows and duplicate emails.
+func (s *Store) BulkCreate(ctx context.Context, users []store.User) (store.BulkResult, error) {
+	if err := ctx.Err(); err != nil {
+		return store.BulkResult{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result store.BulkResult
+	for i := range users {
+		u := &users[i]
+
+		err := store.Validate(*u)
+		if err == nil && s.emailTaken(u.Email, 0) {
+			err = store.ErrDuplicateEmail
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, store.RowError{Row: i, User: *u, Err: err})
+			continue
+		}
+
+		s.insert(ctx, u)
+		result.Inserted++
+	}
+	return result, nil
+}
+
+// Search matches every word of query as a prefix of a word in the name or
+// email, like the FTS5 index. Results are ordered by ID; Rank is always 0.
+func (s *Store) Search(ctx context.Context, query string, limit int) ([]store.SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	terms := splitWords(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	users, _ := s.List(ctx)
+
+	var results []store.SearchResult
+	for _, u := range users {
+		if len(results) == limit {
+			break
+		}
+		if snippet, ok := match(terms, u.Name, u.Email); ok {
+			results = append(results, store.SearchResult{User: u, Snippet: snippet})
+		}
+	}
+	return results, nil
+}
+
+// History returns the recorded changes to a user, oldest first.
+func (s *Store) History(ctx context.Context, id int64) ([]store.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.rows[id]; !ok {
+		return nil, fmt.Errorf("history of user %d: %w", id, store.ErrNotFound)
+	}
+
+	var entries []store.AuditEntry
+	for _, e := range s.audit {
+		if e.UserID == id {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Restore undeletes a user and, if entryID is not zero, resets it to that
+// history entry.
+func (s *Store) Restore(ctx context.Context, id, entryID int64) (store.User, error) {
+	if err := ctx.Err(); err != nil {
+		return store.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rows[id]
+	if !ok {
+		return store.User{}, fmt.Errorf("restore user %d: %w", id, store.ErrNotFound)
+	}
+
+	u := r.user
+	if entryID != 0 {
+		i := int(entryID - 1) // Entry IDs are 1-based positions in s.audit
+		if i < 0 || i >= len(s.audit) || s.audit[i].UserID != id {
+			return store.User{}, fmt.Errorf("restore user %d: audit entry %d: %w", id, entryID, store.ErrNotFound)
+		}
+		u = s.audit[i].User
+	}
+	if s.emailTaken(u.Email, id) {
+		return store.User{}, fmt.Errorf("restore user %d: %w", id, store.ErrDuplicateEmail)
+	}
+
+	u.Version = r.user.Version + 1
+	r.user, r.deleted = u, false
+	s.record(ctx, store.ActionRestore, u)
+	return u, nil
+}
+
+// insert adds u as a new user; s.mu must be held
+func (s *Store) insert(ctx context.Context, u *store.User) {
+	u.ID, u.Version = s.nextID, 1
+	s.nextID++
+
+	s.rows[u.ID] = &row{user: *u}
+	s.record(ctx, store.ActionCreate, *u)
+}
+
+// record appends to the audit log; s.mu must be held
+func (s *Store) record(ctx context.Context, action string, u store.User) {
+	s.audit = append(s.audit, store.AuditEntry{
+		ID:     int64(len(s.audit) + 1),
+		UserID: u.ID,
+		Action: action,
+		Actor:  store.ActorFrom(ctx),
+		At:     time.Now().UTC(),
+		User:   u,
+	})
+}
+
+// emailTaken reports whether an active user other than exceptID has email;
+// s.mu must be held
+func (s *Store) emailTaken(email string, exceptID int64) bool {
+	for id, r := range s.rows {
+		if id != exceptID && !r.deleted && r.user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether every term prefixes some word of the fields, and
+// returns the first matching field with the matched words in <mark>
+func match(terms []string, fields ...string) (string, bool) {
+	var words []string
+	for _, f := range fields {
+		words = append(words, splitWords(f)...)
+	}
+	for _, term := range terms {
+		found := false
+		for _, w := range words {
+			if strings.HasPrefix(strings.ToLower(w), term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+
+	for _, f := range fields {
+		var b strings.Builder
+		marked := false
+		for _, tok := range splitKeep(f) {
+			if isWord(tok) && hasPrefixAny(strings.ToLower(tok), terms) {
+				b.WriteString("<mark>" + tok + "</mark>")
+				marked = true
+			} else {
+				b.WriteString(tok)
+			}
+		}
+		if marked {
+			return b.String(), true
+		}
+	}
+	return "", true
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// splitKeep splits s into alternating runs of word and non-word characters
+func splitKeep(s string) []string {
+	var toks []string
+	start := 0
+	for i, r := range s {
+		if i > start && isWordRune(r) != isWord(s[start:i]) {
+			toks = append(toks, s[start:i])
+			start = i
+		}
+	}
+	if start < len(s) {
+		toks = append(toks, s[start:])
+	}
+	return toks
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func isWord(tok string) bool {
+	for _, r := range tok {
+		return isWordRune(r)
+	}
+	return false
+}
+
+func hasPrefixAny(word string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(word, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package memstore_test
+
+import (
+	"testing"
+
+	"go_lang_tutorial/internal/store"
+	"go_lang_tutorial/internal/store/memstore"
+	"go_lang_tutorial/internal/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Repository {
+		return memstore.New()
+	})
+}
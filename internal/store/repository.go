@@ -0,0 +1,36 @@
+package store
+
+import "context"
+
+// Repository is the storage-independent contract for users. UserRepository
+// implements it on SQLite and memstore.Store in plain Go; another backend
+// (PostgreSQL, MySQL, ...) only has to implement it and pass the
+// conformance suite in internal/storetest to be a drop-in replacement.
+//
+// Implementations must return the errors defined in this package
+// (ErrNotFound, ErrDuplicateEmail, ErrInvalidUser, ErrConflict,
+// ErrSearchUnavailable), wrapped or not, and attribute changes to
+// ActorFrom(ctx) in their history.
+type Repository interface {
+	Create(ctx context.Context, u *User) error
+	Get(ctx context.Context, id int64) (User, error)
+	FindByEmail(ctx context.Context, email string) (User, error)
+	List(ctx context.Context) ([]User, error)
+	Update(ctx context.Context, u *User) error
+	SetAvatar(ctx context.Context, id int64, avatar string) (User, error)
+	Delete(ctx context.Context, id int64) error
+
+	BulkCreate(ctx context.Context, users []User) (BulkResult, error)
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+
+	History(ctx context.Context, id int64) ([]AuditEntry, error)
+	Restore(ctx context.Context, id, entryID int64) (User, error)
+}
+
+var _ Repository = (*UserRepository)(nil)
+
+// Validate checks u the way every Repository must before writing it,
+// returning an error wrapping ErrInvalidUser.
+func Validate(u User) error {
+	return u.validate()
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+// Full-text search needs SQLite's FTS5 module, which go-sqlite3 only
+// compiles in with the sqlite_fts5 build tag:
+//
+//	go run -tags sqlite_fts5 ./advanced/27_http_server
+//
+// Without it EnsureSearchIndex and Search return ErrSearchUnavailable (see
+// search_fts5.go and search_nofts5.go).
+var ErrSearchUnavailable = errors.New("store: full-text search unavailable (build with -tags sqlite_fts5)")
+
+// SearchResult is a user matching a search, best matches first.
+type SearchResult struct {
+	User
+	Rank    float64 `db:"rank" json:"rank"`       // bm25 score; lower is better
+	Snippet string  `db:"snippet" json:"snippet"` // Matching text with terms in <mark>
+}
+
+// matchExpr turns free text into an FTS5 query: every word must match as a
+// prefix. Quoting each word keeps FTS5 operators in user input from being
+// interpreted (or from being a syntax error).
+func matchExpr(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word != "" {
+			terms = append(terms, `"`+word+`"*`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,75 @@
+//go:build sqlite_fts5
+
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"go_lang_tutorial/internal/sqlscan"
+)
+
+// The index is an external-content FTS5 table: it stores only the search
+// index and reads name/email back from users. Triggers keep it in sync.
+const searchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+	name, email,
+	content='users', content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+	INSERT INTO users_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+	INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF name, email ON users BEGIN
+	INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+	INSERT INTO users_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+-- Catch up on rows written while the triggers were missing
+INSERT INTO users_fts (users_fts) VALUES ('rebuild');
+`
+
+// EnsureSearchIndex creates the users_fts index and its triggers if needed
+// and rebuilds the index. Call it after migrations.
+func EnsureSearchIndex(ctx context.Context, db Database) error {
+	if _, err := db.ExecContext(ctx, searchSchema); err != nil {
+		return fmt.Errorf("create search index: %w", err)
+	}
+	return nil
+}
+
+// Search returns up to limit users whose name or email match every word of
+// query as a prefix, best matches first.
+func (r *UserRepository) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	expr := matchExpr(query)
+	if expr == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email, u.age, u.avatar, u.version,
+		       bm25(users_fts) AS rank,
+		       snippet(users_fts, -1, '<mark>', '</mark>', '…', 8) AS snippet
+		FROM users_fts
+		JOIN users u ON u.id = users_fts.rowid
+		WHERE users_fts MATCH ? AND u.deleted_at IS NULL
+		ORDER BY rank
+		LIMIT ?`, expr, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+
+	results, err := sqlscan.ScanAll[SearchResult](rows)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+	return results, nil
+}
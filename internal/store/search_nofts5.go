@@ -0,0 +1,24 @@
+//go:build !sqlite_fts5
+
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// EnsureSearchIndex removes the sync triggers a sqlite_fts5 build may have
+// left in the database: without the FTS5 module they would make every write
+// to users fail. The next sqlite_fts5 build rebuilds the index.
+func EnsureSearchIndex(ctx context.Context, db Database) error {
+	for _, trigger := range []string{"users_fts_insert", "users_fts_delete", "users_fts_update"} {
+		if _, err := db.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+trigger); err != nil {
+			return fmt.Errorf("drop search trigger: %w", err)
+		}
+	}
+	return ErrSearchUnavailable
+}
+
+func (r *UserRepository) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	return nil, ErrSearchUnavailable
+}
@@ -0,0 +1,79 @@
+// Package store is the data layer for the users table created by
+// internal/migrate. It turns driver errors into the domain errors below so
+// that callers never have to inspect SQLite error codes.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"go_lang_tutorial/internal/dbtx"
+)
+
+var (
+	ErrNotFound       = errors.New("store: not found")
+	ErrDuplicateEmail = errors.New("store: email already in use")
+	ErrInvalidUser    = errors.New("store: invalid user")
+	ErrConflict       = errors.New("store: modified concurrently")
+)
+
+// Database is the subset of *sql.DB and *sql.Tx the repositories need, so
+// the same repository works inside and outside a transaction.
+type Database interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// DefaultQueryTimeout bounds every repository call unless the repository is
+// created with WithQueryTimeout. A shorter deadline on the caller's context
+// still wins.
+const DefaultQueryTimeout = 5 * time.Second
+
+// Option configures a repository.
+type Option func(*UserRepository)
+
+// WithQueryTimeout sets the per-call timeout; zero disables it.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(r *UserRepository) {
+		r.timeout = d
+	}
+}
+
+func (r *UserRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// withTx runs fn in a transaction, or in a savepoint when the repository
+// itself was created on a *sql.Tx.
+func (r *UserRepository) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return dbtx.WithTx(ctx, r.db, nil, fn)
+}
+
+// mapError translates driver errors into domain errors.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		// The message names the violated column, e.g.
+		// "UNIQUE constraint failed: users.email"
+		if strings.Contains(sqliteErr.Error(), "users.email") {
+			return ErrDuplicateEmail
+		}
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go_lang_tutorial/internal/database"
+	"go_lang_tutorial/internal/dbtest"
+	"go_lang_tutorial/internal/store"
+	"go_lang_tutorial/internal/storetest"
+)
+
+func TestConformanceMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Repository {
+		return store.NewUserRepository(dbtest.New(t))
+	})
+}
+
+// A file database has a real connection pool, unlike :memory:, which is
+// limited to one connection
+func TestConformanceFile(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Repository {
+		path := filepath.Join(t.TempDir(), "users.db")
+		db, err := database.OpenMigrated(context.Background(), path, database.PoolOptions{MaxOpenConns: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return store.NewUserRepository(db)
+	})
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go_lang_tutorial/internal/sqlscan"
+)
+
+// User is a row of the users table.
+type User struct {
+	ID     int64  `db:"id" json:"id"`
+	Name   string `db:"name" json:"name"`
+	Email  string `db:"email" json:"email"`
+	Age    int    `db:"age" json:"age"`
+	Avatar string `db:"avatar" json:"avatar,omitempty"` // URL path of the uploaded image
+
+	// Version starts at 1 and is incremented by every write. Update only
+	// succeeds if it still matches the stored row.
+	Version int64 `db:"version" json:"version"`
+}
+
+const userColumns = "id, name, email, age, avatar, version"
+
+// Deleted users keep their row (see Delete); every read of active users
+// filters on this.
+const active = "deleted_at IS NULL"
+
+// validate checks what the schema cannot: NOT NULL still admits ""
+func (u User) validate() error {
+	switch {
+	case strings.TrimSpace(u.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidUser)
+	case !strings.Contains(u.Email, "@"):
+		return fmt.Errorf("%w: email %q is not valid", ErrInvalidUser, u.Email)
+	case u.Age < 0:
+		return fmt.Errorf("%w: age must not be negative", ErrInvalidUser)
+	}
+	return nil
+}
+
+// UserRepository provides CRUD access to users.
+type UserRepository struct {
+	db      Database
+	timeout time.Duration
+}
+
+func NewUserRepository(db Database, opts ...Option) *UserRepository {
+	r := &UserRepository{db: db, timeout: DefaultQueryTimeout}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Create inserts u and sets u.ID to the new row's ID.
+func (r *UserRepository) Create(ctx context.Context, u *User) error {
+	if err := u.validate(); err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	created := *u
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO users (name, email, age, avatar) VALUES (?, ?, ?, ?)",
+			u.Name, u.Email, u.Age, u.Avatar)
+		if err != nil {
+			return mapError(err)
+		}
+
+		if created.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		created.Version = 1
+		return audit(ctx, tx, ActionCreate, created)
+	})
+	if err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+	u.ID, u.Version = created.ID, created.Version
+	return nil
+}
+
+// Get returns the user with the given ID or ErrNotFound.
+func (r *UserRepository) Get(ctx context.Context, id int64) (User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	u, err := queryOne(ctx, r.db, "SELECT "+userColumns+" FROM users WHERE id = ? AND "+active, id)
+	if err != nil {
+		return User{}, fmt.Errorf("get user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// FindByEmail returns the user with the given email or ErrNotFound.
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	u, err := queryOne(ctx, r.db, "SELECT "+userColumns+" FROM users WHERE email = ? AND "+active, email)
+	if err != nil {
+		return User{}, fmt.Errorf("find user by email: %w", err)
+	}
+	return u, nil
+}
+
+// List returns all active users ordered by ID.
+func (r *UserRepository) List(ctx context.Context) ([]User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+active+" ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	users, err := sqlscan.ScanAll[User](rows)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return users, nil
+}
+
+// Update overwrites the stored user with u.ID, provided its version is
+// still u.Version, and then increments u.Version. It returns ErrConflict if
+// the user was changed since u was read and ErrNotFound if no such active
+// user exists.
+func (r *UserRepository) Update(ctx context.Context, u *User) error {
+	if err := u.validate(); err != nil {
+		return fmt.Errorf("update user %d: %w", u.ID, err)
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	updated := *u
+	updated.Version++
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE users SET name = ?, email = ?, age = ?, avatar = ?, version = version + 1"+
+				" WHERE id = ? AND version = ? AND "+active,
+			u.Name, u.Email, u.Age, u.Avatar, u.ID, u.Version)
+		if err != nil {
+			return mapError(err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Either the user is gone or the version did not match
+			if _, err := queryOne(ctx, tx, "SELECT "+userColumns+" FROM users WHERE id = ? AND "+active, u.ID); err != nil {
+				return err
+			}
+			return ErrConflict
+		}
+		return audit(ctx, tx, ActionUpdate, updated)
+	})
+	if err != nil {
+		return fmt.Errorf("update user %d: %w", u.ID, err)
+	}
+	u.Version = updated.Version
+	return nil
+}
+
+// SetAvatar changes only the avatar of the user with the given ID and
+// returns the updated user.
+func (r *UserRepository) SetAvatar(ctx context.Context, id int64, avatar string) (User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var u User
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "UPDATE users SET avatar = ?, version = version + 1 WHERE id = ? AND "+active, avatar, id)
+		if err != nil {
+			return mapError(err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+
+		if u, err = queryOne(ctx, tx, "SELECT "+userColumns+" FROM users WHERE id = ?", id); err != nil {
+			return err
+		}
+		return audit(ctx, tx, ActionAvatar, u)
+	})
+	if err != nil {
+		return User{}, fmt.Errorf("set avatar of user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// Delete soft-deletes the user with the given ID: the row stays, with
+// deleted_at set, and can be brought back with Restore. It returns
+// ErrNotFound if no such active user exists.
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		u, err := queryOne(ctx, tx, "SELECT "+userColumns+" FROM users WHERE id = ? AND "+active, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET deleted_at = ?, version = version + 1 WHERE id = ?", time.Now().UTC(), id)
+		if err != nil {
+			return err
+		}
+		u.Version++
+		return audit(ctx, tx, ActionDelete, u)
+	})
+	if err != nil {
+		return fmt.Errorf("delete user %d: %w", id, err)
+	}
+	return nil
+}
+
+// queryOne runs a query expected to return a single user
+func queryOne(ctx context.Context, db Database, query string, args ...any) (User, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err := sqlscan.ScanOne[User](rows)
+	return u, mapError(err)
+}
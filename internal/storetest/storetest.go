@@ -0,0 +1,525 @@
+// Package storetest is a conformance suite for store.Repository
+// implementations. Every backend must pass it unchanged:
+//
+//	storetest.Run(t, func(t *testing.T) store.Repository {
+//		return memstore.New()
+//	})
+//
+// newRepo is called once per subtest and must return an empty repository;
+// register any cleanup with t.Cleanup.
+//
+// The suite only relies on behaviour promised by store.Repository: the
+// domain errors, soft delete, row versions and history. It does not check
+// search ranking or snippets, which are backend-specific.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go_lang_tutorial/internal/store"
+)
+
+// Run runs every conformance test as a subtest of t.
+func Run(t *testing.T, newRepo func(t *testing.T) store.Repository) {
+	for _, tc := range []struct {
+		name string
+		fn   func(t *testing.T, repo store.Repository)
+	}{
+		{"CreateGet", testCreateGet},
+		{"CreateInvalid", testCreateInvalid},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"NotFound", testNotFound},
+		{"FindByEmail", testFindByEmail},
+		{"List", testList},
+		{"Update", testUpdate},
+		{"UpdateConflict", testUpdateConflict},
+		{"SetAvatar", testSetAvatar},
+		{"SoftDelete", testSoftDelete},
+		{"History", testHistory},
+		{"Restore", testRestore},
+		{"RestoreEntry", testRestoreEntry},
+		{"BulkCreate", testBulkCreate},
+		{"Search", testSearch},
+		{"CanceledContext", testCanceledContext},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepo(t))
+		})
+	}
+}
+
+// ===== HELPERS =====
+
+func create(t *testing.T, repo store.Repository, name, email string) store.User {
+	t.Helper()
+
+	u := store.User{Name: name, Email: email, Age: 30}
+	if err := repo.Create(context.Background(), &u); err != nil {
+		t.Fatalf("Create(%s): %v", email, err)
+	}
+	return u
+}
+
+func wantErr(t *testing.T, op string, err, target error) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want %v", op, err, target)
+	}
+}
+
+func ids(users []store.User) []int64 {
+	out := make([]int64, len(users))
+	for i, u := range users {
+		out[i] = u.ID
+	}
+	return out
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ===== TESTS =====
+
+func testCreateGet(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	u := create(t, repo, "Alice", "alice@example.com")
+
+	if u.ID == 0 {
+		t.Fatal("Create did not set ID")
+	}
+	if u.Version != 1 {
+		t.Fatalf("new user has version %d, want 1", u.Version)
+	}
+
+	got, err := repo.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got != u {
+		t.Fatalf("Get = %+v, want %+v", got, u)
+	}
+
+	other := create(t, repo, "Bob", "bob@example.com")
+	if other.ID == u.ID {
+		t.Fatalf("two users share ID %d", u.ID)
+	}
+}
+
+func testCreateInvalid(t *testing.T, repo store.Repository) {
+	for _, u := range []store.User{
+		{Name: "", Email: "empty@example.com"},
+		{Name: "No At", Email: "not-an-email"},
+		{Name: "Negative", Email: "neg@example.com", Age: -1},
+	} {
+		u := u
+		wantErr(t, "Create("+u.Email+")", repo.Create(context.Background(), &u), store.ErrInvalidUser)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, repo store.Repository) {
+	create(t, repo, "Alice", "alice@example.com")
+
+	dup := store.User{Name: "Other Alice", Email: "alice@example.com"}
+	wantErr(t, "Create duplicate", repo.Create(context.Background(), &dup), store.ErrDuplicateEmail)
+}
+
+func testNotFound(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+
+	_, err := repo.Get(ctx, 999)
+	wantErr(t, "Get", err, store.ErrNotFound)
+
+	_, err = repo.SetAvatar(ctx, 999, "/a.png")
+	wantErr(t, "SetAvatar", err, store.ErrNotFound)
+
+	wantErr(t, "Delete", repo.Delete(ctx, 999), store.ErrNotFound)
+
+	_, err = repo.History(ctx, 999)
+	wantErr(t, "History", err, store.ErrNotFound)
+
+	_, err = repo.Restore(ctx, 999, 0)
+	wantErr(t, "Restore", err, store.ErrNotFound)
+
+	u := store.User{ID: 999, Name: "Ghost", Email: "ghost@example.com", Version: 1}
+	wantErr(t, "Update", repo.Update(ctx, &u), store.ErrNotFound)
+}
+
+func testFindByEmail(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	create(t, repo, "Alice", "alice@example.com")
+	bob := create(t, repo, "Bob", "bob@example.com")
+
+	got, err := repo.FindByEmail(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+	if got.ID != bob.ID {
+		t.Fatalf("FindByEmail returned user %d, want %d", got.ID, bob.ID)
+	}
+
+	_, err = repo.FindByEmail(ctx, "nobody@example.com")
+	wantErr(t, "FindByEmail missing", err, store.ErrNotFound)
+}
+
+func testList(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+
+	users, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if users == nil || len(users) != 0 {
+		t.Fatalf("new repository lists %#v, want an empty non-nil slice", users)
+	}
+
+	a := create(t, repo, "Alice", "alice@example.com")
+	b := create(t, repo, "Bob", "bob@example.com")
+	c := create(t, repo, "Carol", "carol@example.com")
+
+	users, err = repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := []int64{a.ID, b.ID, c.ID}; !equalIDs(ids(users), want) {
+		t.Fatalf("List IDs = %v, want %v", ids(users), want)
+	}
+}
+
+func testUpdate(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	u := create(t, repo, "Alice", "alice@example.com")
+	bob := create(t, repo, "Bob", "bob@example.com")
+
+	u.Name, u.Age = "Alice Smith", 31
+	if err := repo.Update(ctx, &u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if u.Version != 2 {
+		t.Fatalf("Update left version %d, want 2", u.Version)
+	}
+
+	got, err := repo.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got != u {
+		t.Fatalf("Get after Update = %+v, want %+v", got, u)
+	}
+
+	taken := u
+	taken.Email = bob.Email
+	wantErr(t, "Update to taken email", repo.Update(ctx, &taken), store.ErrDuplicateEmail)
+
+	invalid := u
+	invalid.Name = ""
+	wantErr(t, "Update invalid", repo.Update(ctx, &invalid), store.ErrInvalidUser)
+}
+
+func testUpdateConflict(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	first := create(t, repo, "Alice", "alice@example.com")
+	second := first // Both writers read version 1
+
+	first.Age = 40
+	if err := repo.Update(ctx, &first); err != nil {
+		t.Fatalf("first Update: %v", err)
+	}
+
+	second.Age = 50
+	wantErr(t, "stale Update", repo.Update(ctx, &second), store.ErrConflict)
+
+	got, err := repo.Get(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Age != 40 {
+		t.Fatalf("stale Update overwrote age: got %d, want 40", got.Age)
+	}
+
+	// Other writes bump the version too
+	if _, err := repo.SetAvatar(ctx, first.ID, "/a.png"); err != nil {
+		t.Fatalf("SetAvatar: %v", err)
+	}
+	first.Age = 41
+	wantErr(t, "Update after SetAvatar", repo.Update(ctx, &first), store.ErrConflict)
+}
+
+func testSetAvatar(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	u := create(t, repo, "Alice", "alice@example.com")
+
+	got, err := repo.SetAvatar(ctx, u.ID, "/static/avatars/ab/ab.png")
+	if err != nil {
+		t.Fatalf("SetAvatar: %v", err)
+	}
+	if got.Avatar != "/static/avatars/ab/ab.png" || got.Name != u.Name {
+		t.Fatalf("SetAvatar returned %+v", got)
+	}
+	if got.Version != u.Version+1 {
+		t.Fatalf("SetAvatar left version %d, want %d", got.Version, u.Version+1)
+	}
+}
+
+func testSoftDelete(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	alice := create(t, repo, "Alice", "alice@example.com")
+	bob := create(t, repo, "Bob", "bob@example.com")
+
+	if err := repo.Delete(ctx, alice.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err := repo.Get(ctx, alice.ID)
+	wantErr(t, "Get deleted", err, store.ErrNotFound)
+	_, err = repo.FindByEmail(ctx, alice.Email)
+	wantErr(t, "FindByEmail deleted", err, store.ErrNotFound)
+	wantErr(t, "Delete twice", repo.Delete(ctx, alice.ID), store.ErrNotFound)
+
+	deleted := alice
+	deleted.Age = 99
+	wantErr(t, "Update deleted", repo.Update(ctx, &deleted), store.ErrNotFound)
+
+	users, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := []int64{bob.ID}; !equalIDs(ids(users), want) {
+		t.Fatalf("List after Delete = %v, want %v", ids(users), want)
+	}
+
+	// The email of a deleted user can be used again
+	create(t, repo, "New Alice", alice.Email)
+}
+
+func testHistory(t *testing.T, repo store.Repository) {
+	ctx := store.WithActor(context.Background(), "tester")
+	u := store.User{Name: "Alice", Email: "alice@example.com"}
+	if err := repo.Create(ctx, &u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	create(t, repo, "Bob", "bob@example.com") // Must not show up
+
+	u.Age = 31
+	if err := repo.Update(ctx, &u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := repo.SetAvatar(context.Background(), u.ID, "/a.png"); err != nil {
+		t.Fatalf("SetAvatar: %v", err)
+	}
+	if err := repo.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	history, err := repo.History(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+
+	want := []struct {
+		action, actor string
+		age           int
+	}{
+		{store.ActionCreate, "tester", 0},
+		{store.ActionUpdate, "tester", 31},
+		{store.ActionAvatar, store.DefaultActor, 31},
+		{store.ActionDelete, "tester", 31},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("History has %d entries, want %d: %+v", len(history), len(want), history)
+	}
+	for i, w := range want {
+		e := history[i]
+		if e.UserID != u.ID || e.Action != w.action || e.Actor != w.actor || e.User.Age != w.age {
+			t.Errorf("entry %d = {user %d, %s by %s, age %d}, want {user %d, %s by %s, age %d}",
+				i, e.UserID, e.Action, e.Actor, e.User.Age, u.ID, w.action, w.actor, w.age)
+		}
+		if e.At.IsZero() {
+			t.Errorf("entry %d has no timestamp", i)
+		}
+		if i > 0 && e.ID <= history[i-1].ID {
+			t.Errorf("entry IDs not increasing: %d after %d", e.ID, history[i-1].ID)
+		}
+	}
+}
+
+func testRestore(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	u := create(t, repo, "Alice", "alice@example.com")
+
+	if err := repo.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	restored, err := repo.Restore(ctx, u.ID, 0)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.Name != u.Name || restored.Version <= u.Version {
+		t.Fatalf("Restore returned %+v", restored)
+	}
+
+	got, err := repo.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Get after Restore: %v", err)
+	}
+	if got != restored {
+		t.Fatalf("Get after Restore = %+v, want %+v", got, restored)
+	}
+
+	// Restoring must not create a second active user with the same email
+	if err := repo.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	create(t, repo, "New Alice", u.Email)
+	_, err = repo.Restore(ctx, u.ID, 0)
+	wantErr(t, "Restore with taken email", err, store.ErrDuplicateEmail)
+}
+
+func testRestoreEntry(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	u := create(t, repo, "Alice", "alice@example.com")
+	other := create(t, repo, "Bob", "bob@example.com")
+
+	u.Name, u.Age = "Alice Smith", 45
+	if err := repo.Update(ctx, &u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	history, err := repo.History(ctx, u.ID)
+	if err != nil || len(history) == 0 {
+		t.Fatalf("History: %v (%d entries)", err, len(history))
+	}
+
+	restored, err := repo.Restore(ctx, u.ID, history[0].ID)
+	if err != nil {
+		t.Fatalf("Restore entry: %v", err)
+	}
+	if restored.Name != "Alice" || restored.Age != 30 || restored.Version != u.Version+1 {
+		t.Fatalf("Restore entry returned %+v", restored)
+	}
+
+	// An entry of another user is not part of this user's history
+	otherHistory, err := repo.History(ctx, other.ID)
+	if err != nil || len(otherHistory) == 0 {
+		t.Fatalf("History: %v (%d entries)", err, len(otherHistory))
+	}
+	_, err = repo.Restore(ctx, u.ID, otherHistory[0].ID)
+	wantErr(t, "Restore foreign entry", err, store.ErrNotFound)
+}
+
+func testBulkCreate(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+	create(t, repo, "Alice", "alice@example.com")
+
+	users := []store.User{
+		{Name: "Bob", Email: "bob@example.com"},
+		{Name: "", Email: "invalid@example.com"},
+		{Name: "Alice Again", Email: "alice@example.com"},
+		{Name: "Carol", Email: "carol@example.com"},
+		{Name: "Bob Again", Email: "bob@example.com"}, // Duplicate within the batch
+	}
+
+	result, err := repo.BulkCreate(ctx, users)
+	if err != nil {
+		t.Fatalf("BulkCreate: %v", err)
+	}
+	if result.Inserted != 2 {
+		t.Fatalf("BulkCreate inserted %d, want 2", result.Inserted)
+	}
+
+	wantRows := map[int]error{1: store.ErrInvalidUser, 2: store.ErrDuplicateEmail, 4: store.ErrDuplicateEmail}
+	if len(result.Errors) != len(wantRows) {
+		t.Fatalf("BulkCreate reported %d errors, want %d: %v", len(result.Errors), len(wantRows), result.Errors)
+	}
+	for _, rowErr := range result.Errors {
+		if want, ok := wantRows[rowErr.Row]; !ok || !errors.Is(rowErr, want) {
+			t.Errorf("unexpected row error %v", rowErr)
+		}
+	}
+
+	if users[0].ID == 0 || users[3].ID == 0 {
+		t.Fatal("BulkCreate did not set IDs of inserted users")
+	}
+	if _, err := repo.Get(ctx, users[3].ID); err != nil {
+		t.Fatalf("Get bulk-created user: %v", err)
+	}
+}
+
+func testSearch(t *testing.T, repo store.Repository) {
+	ctx := context.Background()
+
+	_, err := repo.Search(ctx, "anything", 10)
+	if errors.Is(err, store.ErrSearchUnavailable) {
+		t.Skip("search not available in this build")
+	}
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	alice := create(t, repo, "Alice Smith", "alice@example.com")
+	bob := create(t, repo, "Bob Jones", "bob@example.org")
+	deleted := create(t, repo, "Alina Gone", "alina@example.com")
+	if err := repo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []int64
+	}{
+		{"ali", []int64{alice.ID}}, // Prefix match; the deleted user is excluded
+		{"JONES", []int64{bob.ID}}, // Case-insensitive
+		{"smith alice", []int64{alice.ID}},
+		{"smith bob", nil}, // Every word must match
+		{"nobody", nil},
+	} {
+		results, err := repo.Search(ctx, tc.query, 10)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tc.query, err)
+		}
+		got := make([]int64, len(results))
+		for i, r := range results {
+			got[i] = r.ID
+		}
+		if !equalIDs(got, tc.want) {
+			t.Errorf("Search(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	results, err := repo.Search(ctx, "example", 1)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Search with limit 1 returned %d results", len(results))
+	}
+}
+
+func testCanceledContext(t *testing.T, repo store.Repository) {
+	u := create(t, repo, "Alice", "alice@example.com")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Get(ctx, u.ID)
+	wantErr(t, "Get", err, context.Canceled)
+
+	v := store.User{Name: "Bob", Email: "bob@example.com"}
+	wantErr(t, "Create", repo.Create(ctx, &v), context.Canceled)
+
+	if _, err := repo.FindByEmail(context.Background(), v.Email); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("canceled Create still inserted the user (err %v)", err)
+	}
+}
@@ -0,0 +1,161 @@
+package taskqueue
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"time"
+
+	"go_lang_tutorial/internal/dbtx"
+	"go_lang_tutorial/internal/workerpool"
+)
+
+// ===== CONSUMING WITH A WORKER POOL =====
+// Consume is the loop every worker process would otherwise write: lease a
+// task, hand it to a pool worker, and record the outcome. The next task is
+// only leased once Submit has accepted the previous one, so a busy pool
+// holds few leases it cannot work on yet (its queue size plus one), and
+// the pool's autoscaling sees the backlog as it would for in-memory jobs.
+
+// Handler processes one task. Returning nil acknowledges the task; any
+// other error schedules a retry, and errors marked with
+// workerpool.Permanent dead-letter the task right away, as does a panic.
+type Handler func(ctx context.Context, t *Task) error
+
+// Consume leases tasks and runs handle for each of them on pool until ctx
+// is done, then returns ctx's error. Tasks still waiting in the pool's
+// queue are released without counting an attempt. Running handlers are
+// not cancelled with ctx; call pool.Shutdown afterwards to wait for them.
+//
+// While handle runs, the lease is extended every half visibility timeout.
+// Retries are the queue's business: the pool sees every failure as
+// permanent, so its own RetryPolicy never runs a handler twice.
+func (q *Queue) Consume(ctx context.Context, pool *workerpool.WorkerPool[struct{}], handle Handler) error {
+	for {
+		t, err := q.Lease(ctx)
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, ErrEmpty) || dbtx.IsBusy(err):
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(q.poll):
+			}
+			continue
+		default:
+			return err
+		}
+
+		// The job is cancelled with ctx only until it starts: a running
+		// handler is left to finish, and only an abandoning Shutdown
+		// cancels it
+		jobCtx, cancelJob := context.WithCancel(context.WithoutCancel(ctx))
+		stopCancel := context.AfterFunc(ctx, cancelJob)
+		f, err := pool.Submit(jobCtx, q.job(t, handle, stopCancel))
+		if err != nil {
+			// Never started, so it should not count as an attempt
+			cancelJob()
+			q.release(context.WithoutCancel(ctx), t)
+			return err
+		}
+
+		// The pool skips queued jobs once ctx ends or Shutdown gives up on
+		// them; hand their tasks back instead of leaving them leased until
+		// the visibility timeout
+		go func() {
+			if f.Attempts() == 0 {
+				q.release(context.WithoutCancel(ctx), t)
+			}
+			cancelJob()
+		}()
+	}
+}
+
+// job runs handle for t. started detaches the job from the consumer's
+// context and reports false if the consumer stopped before that.
+func (q *Queue) job(t *Task, handle Handler, started func() bool) workerpool.Job[struct{}] {
+	return func(ctx context.Context) (struct{}, error) {
+		if !started() {
+			// Cancelled just as a worker picked it up: not an attempt
+			err := q.release(context.WithoutCancel(ctx), t)
+			return struct{}{}, workerpool.Permanent(errors.Join(context.Canceled, err))
+		}
+		stop, err := q.keepLeased(ctx, t)
+		if err != nil {
+			// Expired while waiting in the pool's queue; another consumer
+			// may be running it already
+			return struct{}{}, workerpool.Permanent(err)
+		}
+		err = runHandler(ctx, t, handle)
+		stop()
+
+		// Record the outcome even if the pool is shutting down
+		ctx = context.WithoutCancel(ctx)
+		switch {
+		case err == nil:
+			err = q.Ack(ctx, t)
+		case workerpool.IsPermanent(err) || errors.As(err, new(*workerpool.PanicError)):
+			err = errors.Join(err, q.Bury(ctx, t, err))
+		default:
+			err = errors.Join(err, q.Nack(ctx, t, err))
+		}
+		return struct{}{}, workerpool.Permanent(err)
+	}
+}
+
+// runHandler calls handle, turning a panic into a *workerpool.PanicError.
+// The pool would recover it too, but only after the job had returned
+// without recording the outcome.
+func runHandler(ctx context.Context, t *Task, handle Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &workerpool.PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return handle(ctx, t)
+}
+
+// keepLeased extends the lease of t whenever less than half the visibility
+// timeout is left, until stop is called or ctx ends. It fails with
+// ErrLeaseLost if the lease has already run out and been taken over.
+func (q *Queue) keepLeased(ctx context.Context, t *Task) (stop func(), err error) {
+	until := t.LeasedUntil
+	if time.Until(until) < q.visibility/2 {
+		until = time.Now().Add(q.visibility)
+		if err := q.extend(ctx, t, until); errors.Is(err, ErrLeaseLost) {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(time.Until(until) - q.visibility/2)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			next := time.Now().Add(q.visibility)
+			switch err := q.extend(ctx, t, next); {
+			case err == nil:
+				until = next
+				timer.Reset(time.Until(until) - q.visibility/2)
+			case dbtx.IsBusy(err):
+				timer.Reset(q.poll)
+			default:
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
@@ -0,0 +1,508 @@
+// Package taskqueue is a durable task queue stored in SQLite, in the tables
+// created by migration 0005_create_task_queue. Tasks survive restarts,
+// and a worker that crashes mid-task only delays it.
+//
+//	q := taskqueue.New(db, "emails")
+//	id, err := q.Enqueue(ctx, payload, taskqueue.EnqueueOptions{Priority: 10})
+//	...
+//	t, err := q.Lease(ctx) // ErrEmpty if no task is visible
+//	...
+//	err = send(t.Payload)
+//	if err != nil {
+//		q.Nack(ctx, t, err) // retried later, or dead-lettered
+//	} else {
+//		q.Ack(ctx, t) // done, deleted
+//	}
+//
+// Leasing a task hides it from other consumers for the visibility timeout.
+// If it is neither acknowledged nor extended by then, it becomes visible
+// again and another consumer gets it, so handlers must be idempotent: a
+// task runs at least once, not exactly once. Consume does the leasing,
+// acknowledging and lease extension for a worker pool.
+package taskqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"time"
+
+	"go_lang_tutorial/internal/dbtx"
+	"go_lang_tutorial/internal/sqlscan"
+)
+
+var (
+	// ErrEmpty is returned by Lease when no task is visible.
+	ErrEmpty = errors.New("taskqueue: no task available")
+
+	// ErrLeaseLost is returned when acknowledging a task whose lease has
+	// expired and possibly been taken over by another consumer.
+	ErrLeaseLost = errors.New("taskqueue: lease expired")
+
+	ErrNotFound = errors.New("taskqueue: task not found")
+)
+
+// Defaults for queues created without options.
+const (
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultMaxAttempts       = 5
+	DefaultPollInterval      = 500 * time.Millisecond
+)
+
+// Task is a leased task.
+type Task struct {
+	ID          int64
+	Queue       string
+	Payload     []byte
+	Priority    int
+	Attempts    int // Including the current one
+	MaxAttempts int
+	LastError   string // Of the previous attempt
+	CreatedAt   time.Time
+	LeasedUntil time.Time
+
+	lease string // Proves ownership in Ack, Nack and Extend
+}
+
+// DeadTask is a task that was moved to the dead-letter table.
+type DeadTask struct {
+	ID          int64
+	Queue       string
+	Payload     []byte
+	Priority    int
+	Attempts    int
+	MaxAttempts int
+	LastError   string
+	CreatedAt   time.Time
+	FailedAt    time.Time
+}
+
+// Queue is one named queue in the tasks table. Several queues can share a
+// database, and several processes can consume the same queue.
+type Queue struct {
+	db          *sql.DB
+	name        string
+	visibility  time.Duration
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	poll        time.Duration
+}
+
+// Option configures a queue.
+type Option func(*Queue)
+
+// WithVisibilityTimeout sets how long a leased task stays hidden from other
+// consumers.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(q *Queue) {
+		q.visibility = d
+	}
+}
+
+// WithMaxAttempts sets the default number of attempts before a task is
+// dead-lettered.
+func WithMaxAttempts(n int) Option {
+	return func(q *Queue) {
+		q.maxAttempts = n
+	}
+}
+
+// WithRetryDelay sets the delay after the first failed attempt, which
+// doubles with every further failure up to max. The default is 1s and 5m.
+func WithRetryDelay(base, max time.Duration) Option {
+	return func(q *Queue) {
+		q.baseDelay, q.maxDelay = base, max
+	}
+}
+
+// WithPollInterval sets how often Consume looks for new tasks while the
+// queue is empty.
+func WithPollInterval(d time.Duration) Option {
+	return func(q *Queue) {
+		q.poll = d
+	}
+}
+
+// New returns the queue called name in db, which must have been migrated.
+func New(db *sql.DB, name string, opts ...Option) *Queue {
+	q := &Queue{
+		db:          db,
+		name:        name,
+		visibility:  DefaultVisibilityTimeout,
+		maxAttempts: DefaultMaxAttempts,
+		baseDelay:   time.Second,
+		maxDelay:    5 * time.Minute,
+		poll:        DefaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.visibility <= 0 {
+		q.visibility = DefaultVisibilityTimeout
+	}
+	if q.maxAttempts < 1 {
+		q.maxAttempts = 1
+	}
+	if q.poll <= 0 {
+		q.poll = DefaultPollInterval
+	}
+	return q
+}
+
+// Name returns the queue's name.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// ===== PRODUCING =====
+
+// EnqueueOptions are per-task settings; the zero value runs the task as
+// soon as possible with default priority.
+type EnqueueOptions struct {
+	Priority    int           // Higher priorities are leased first
+	Delay       time.Duration // Hide the task for this long
+	MaxAttempts int           // Zero uses the queue's default
+}
+
+// Enqueue adds a task and returns its ID.
+func (q *Queue) Enqueue(ctx context.Context, payload []byte, opts EnqueueOptions) (int64, error) {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = q.maxAttempts
+	}
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	now := time.Now()
+	res, err := q.db.ExecContext(ctx,
+		"INSERT INTO tasks (queue, payload, priority, max_attempts, visible_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		q.name, payload, opts.Priority, maxAttempts, now.Add(opts.Delay).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("enqueue on %s: %w", q.name, err)
+	}
+	return res.LastInsertId()
+}
+
+// ===== CONSUMING =====
+
+// taskRow is a tasks row with times as stored
+type taskRow struct {
+	ID          int64          `db:"id"`
+	Queue       string         `db:"queue"`
+	Payload     []byte         `db:"payload"`
+	Priority    int            `db:"priority"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	LastError   string         `db:"last_error"`
+	CreatedAt   int64          `db:"created_at"`
+	VisibleAt   int64          `db:"visible_at"`
+	Lease       sql.NullString `db:"lease"`
+}
+
+const taskColumns = "id, queue, payload, priority, attempts, max_attempts, last_error, created_at, visible_at, lease"
+
+// Lease takes the visible task with the highest priority, oldest first, and
+// hides it for the visibility timeout. It returns ErrEmpty if there is none.
+//
+// Tasks whose lease expired on their last attempt, e.g. because they keep
+// crashing the worker, are dead-lettered instead of being leased again.
+func (q *Queue) Lease(ctx context.Context) (*Task, error) {
+	now := time.Now()
+	lease, err := newLease()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		row   taskRow
+		found bool
+	)
+	err = dbtx.WithTx(ctx, q.db, nil, func(tx *sql.Tx) error {
+		if err := q.buryExpired(ctx, tx, now); err != nil {
+			return err
+		}
+
+		// A single statement, so two consumers can never lease the same task
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE tasks SET attempts = attempts + 1, visible_at = ?, lease = ?
+			WHERE id = (
+				SELECT id FROM tasks WHERE queue = ? AND visible_at <= ?
+				ORDER BY priority DESC, visible_at, id LIMIT 1
+			)
+			RETURNING `+taskColumns,
+			now.Add(q.visibility).UnixMilli(), lease, q.name, now.UnixMilli())
+		if err != nil {
+			return err
+		}
+		row, err = sqlscan.ScanOne[taskRow](rows)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil // Still commit what buryExpired did
+		}
+		found = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lease from %s: %w", q.name, err)
+	}
+	if !found {
+		return nil, ErrEmpty
+	}
+
+	return &Task{
+		ID:          row.ID,
+		Queue:       row.Queue,
+		Payload:     row.Payload,
+		Priority:    row.Priority,
+		Attempts:    row.Attempts,
+		MaxAttempts: row.MaxAttempts,
+		LastError:   row.LastError,
+		CreatedAt:   time.UnixMilli(row.CreatedAt),
+		LeasedUntil: time.UnixMilli(row.VisibleAt),
+		lease:       row.Lease.String,
+	}, nil
+}
+
+// Ack marks t as done and deletes it.
+func (q *Queue) Ack(ctx context.Context, t *Task) error {
+	res, err := q.db.ExecContext(ctx, "DELETE FROM tasks WHERE id = ? AND lease = ?", t.ID, t.lease)
+	if err != nil {
+		return fmt.Errorf("ack task %d: %w", t.ID, err)
+	}
+	return checkLease(res, t.ID)
+}
+
+// Extend keeps t hidden for d from now, for tasks that take longer than
+// the visibility timeout.
+func (q *Queue) Extend(ctx context.Context, t *Task, d time.Duration) error {
+	until := time.Now().Add(d)
+	if err := q.extend(ctx, t, until); err != nil {
+		return err
+	}
+	t.LeasedUntil = until
+	return nil
+}
+
+func (q *Queue) extend(ctx context.Context, t *Task, until time.Time) error {
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE tasks SET visible_at = ? WHERE id = ? AND lease = ?", until.UnixMilli(), t.ID, t.lease)
+	if err != nil {
+		return fmt.Errorf("extend task %d: %w", t.ID, err)
+	}
+	return checkLease(res, t.ID)
+}
+
+// Nack records a failed attempt of t. The task becomes visible again after
+// the retry delay, or is dead-lettered if it has used up its attempts.
+func (q *Queue) Nack(ctx context.Context, t *Task, cause error) error {
+	if t.Attempts >= t.MaxAttempts {
+		return q.Bury(ctx, t, cause)
+	}
+
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE tasks SET visible_at = ?, lease = NULL, last_error = ? WHERE id = ? AND lease = ?",
+		time.Now().Add(q.retryDelay(t.Attempts)).UnixMilli(), errorText(cause), t.ID, t.lease)
+	if err != nil {
+		return fmt.Errorf("nack task %d: %w", t.ID, err)
+	}
+	return checkLease(res, t.ID)
+}
+
+// Bury moves t to the dead-letter table without further attempts, e.g.
+// because its payload cannot be processed.
+func (q *Queue) Bury(ctx context.Context, t *Task, cause error) error {
+	err := dbtx.WithTx(ctx, q.db, nil, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO dead_tasks (id, queue, payload, priority, attempts, max_attempts, last_error, created_at, failed_at)
+			SELECT id, queue, payload, priority, attempts, max_attempts, ?, created_at, ?
+			FROM tasks WHERE id = ? AND lease = ?`,
+			errorText(cause), time.Now().UnixMilli(), t.ID, t.lease)
+		if err != nil {
+			return err
+		}
+		if err := checkLease(res, t.ID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?", t.ID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("bury task %d: %w", t.ID, err)
+	}
+	return nil
+}
+
+// buryExpired moves tasks whose lease has run out and that have no
+// attempts left to the dead-letter table
+func (q *Queue) buryExpired(ctx context.Context, tx *sql.Tx, now time.Time) error {
+	const expired = "queue = ? AND lease IS NOT NULL AND visible_at <= ? AND attempts >= max_attempts"
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO dead_tasks (id, queue, payload, priority, attempts, max_attempts, last_error, created_at, failed_at)
+		SELECT id, queue, payload, priority, attempts, max_attempts, ?, created_at, ?
+		FROM tasks WHERE `+expired,
+		errorText(ErrLeaseLost), now.UnixMilli(), q.name, now.UnixMilli())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM tasks WHERE "+expired, q.name, now.UnixMilli())
+	return err
+}
+
+// release gives t back without counting the attempt, for tasks that were
+// leased but never started
+func (q *Queue) release(ctx context.Context, t *Task) error {
+	res, err := q.db.ExecContext(ctx,
+		"UPDATE tasks SET visible_at = ?, lease = NULL, attempts = attempts - 1 WHERE id = ? AND lease = ?",
+		time.Now().UnixMilli(), t.ID, t.lease)
+	if err != nil {
+		return fmt.Errorf("release task %d: %w", t.ID, err)
+	}
+	return checkLease(res, t.ID)
+}
+
+// retryDelay returns the delay after the given failed attempt: baseDelay
+// doubling per attempt up to maxDelay, somewhere in [delay/2, delay] so
+// that tasks failing together don't retry in lockstep
+func (q *Queue) retryDelay(attempt int) time.Duration {
+	delay := q.baseDelay
+	for i := 1; i < attempt && delay < q.maxDelay; i++ {
+		delay *= 2
+	}
+	if q.maxDelay > 0 && delay > q.maxDelay {
+		delay = q.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(mathrand.Int63n(int64(delay/2)+1))
+}
+
+func checkLease(res sql.Result, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("task %d: %w", id, ErrLeaseLost)
+	}
+	return nil
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func newLease() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ===== DEAD LETTERS =====
+
+type deadRow struct {
+	ID          int64  `db:"id"`
+	Queue       string `db:"queue"`
+	Payload     []byte `db:"payload"`
+	Priority    int    `db:"priority"`
+	Attempts    int    `db:"attempts"`
+	MaxAttempts int    `db:"max_attempts"`
+	LastError   string `db:"last_error"`
+	CreatedAt   int64  `db:"created_at"`
+	FailedAt    int64  `db:"failed_at"`
+}
+
+// DeadLetters returns up to limit dead-lettered tasks of the queue, most
+// recent failure first.
+func (q *Queue) DeadLetters(ctx context.Context, limit int) ([]DeadTask, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT id, queue, payload, priority, attempts, max_attempts, last_error, created_at, failed_at
+		FROM dead_tasks WHERE queue = ? ORDER BY failed_at DESC, id DESC LIMIT ?`, q.name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("dead letters of %s: %w", q.name, err)
+	}
+	deadRows, err := sqlscan.ScanAll[deadRow](rows)
+	if err != nil {
+		return nil, fmt.Errorf("dead letters of %s: %w", q.name, err)
+	}
+
+	tasks := make([]DeadTask, len(deadRows))
+	for i, row := range deadRows {
+		tasks[i] = DeadTask{
+			ID:          row.ID,
+			Queue:       row.Queue,
+			Payload:     row.Payload,
+			Priority:    row.Priority,
+			Attempts:    row.Attempts,
+			MaxAttempts: row.MaxAttempts,
+			LastError:   row.LastError,
+			CreatedAt:   time.UnixMilli(row.CreatedAt),
+			FailedAt:    time.UnixMilli(row.FailedAt),
+		}
+	}
+	return tasks, nil
+}
+
+// Requeue moves a dead-lettered task back into the queue with a fresh set
+// of attempts. It returns ErrNotFound if there is no such dead task.
+func (q *Queue) Requeue(ctx context.Context, id int64) error {
+	err := dbtx.WithTx(ctx, q.db, nil, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO tasks (id, queue, payload, priority, max_attempts, last_error, visible_at, created_at)
+			SELECT id, queue, payload, priority, max_attempts, last_error, ?, created_at
+			FROM dead_tasks WHERE id = ? AND queue = ?`,
+			time.Now().UnixMilli(), id, q.name)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM dead_tasks WHERE id = ?", id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("requeue task %d: %w", id, err)
+	}
+	return nil
+}
+
+// ===== STATISTICS =====
+
+// Stats counts the tasks of a queue by state.
+type Stats struct {
+	Ready   int `json:"ready"`   // Visible now, including expired leases
+	Delayed int `json:"delayed"` // Enqueued with a delay or waiting to be retried
+	Leased  int `json:"leased"`
+	Dead    int `json:"dead"`
+}
+
+// Stats returns the current counts for the queue.
+func (q *Queue) Stats(ctx context.Context) (Stats, error) {
+	now := time.Now().UnixMilli()
+	var s Stats
+	err := q.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(visible_at <= ?), 0),
+			COALESCE(SUM(visible_at > ? AND lease IS NULL), 0),
+			COALESCE(SUM(visible_at > ? AND lease IS NOT NULL), 0),
+			(SELECT count(*) FROM dead_tasks WHERE queue = ?)
+		FROM tasks WHERE queue = ?`,
+		now, now, now, q.name, q.name).Scan(&s.Ready, &s.Delayed, &s.Leased, &s.Dead)
+	if err != nil {
+		return Stats{}, fmt.Errorf("stats of %s: %w", q.name, err)
+	}
+	return s, nil
+}
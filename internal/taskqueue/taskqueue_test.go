@@ -0,0 +1,360 @@
+package taskqueue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/dbtest"
+	"go_lang_tutorial/internal/leakcheck"
+	"go_lang_tutorial/internal/workerpool"
+)
+
+var errFlaky = errors.New("flaky")
+
+func newQueue(t *testing.T, opts ...Option) *Queue {
+	return New(dbtest.New(t), "test", opts...)
+}
+
+func enqueue(t *testing.T, q *Queue, payload string, opts EnqueueOptions) int64 {
+	t.Helper()
+	id, err := q.Enqueue(context.Background(), []byte(payload), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func lease(t *testing.T, q *Queue) *Task {
+	t.Helper()
+	task, err := q.Lease(context.Background())
+	if err != nil {
+		t.Fatalf("Lease() = %v", err)
+	}
+	return task
+}
+
+func stats(t *testing.T, q *Queue) Stats {
+	t.Helper()
+	s, err := q.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// eventually polls cond until it holds or a second has passed
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestLeaseAck(t *testing.T) {
+	q := newQueue(t)
+	ctx := context.Background()
+	low := enqueue(t, q, "low", EnqueueOptions{})
+	high := enqueue(t, q, "high", EnqueueOptions{Priority: 10})
+	enqueue(t, q, "later", EnqueueOptions{Delay: time.Hour})
+
+	first := lease(t, q)
+	if first.ID != high || string(first.Payload) != "high" || first.Attempts != 1 {
+		t.Errorf("first Lease() = %+v, want the high-priority task on attempt 1", first)
+	}
+	if second := lease(t, q); second.ID != low {
+		t.Errorf("second Lease() = task %d, want %d", second.ID, low)
+	}
+	if _, err := q.Lease(ctx); !errors.Is(err, ErrEmpty) {
+		t.Errorf("third Lease() = %v, want ErrEmpty: the rest is leased or delayed", err)
+	}
+	if s := stats(t, q); s != (Stats{Leased: 2, Delayed: 1}) {
+		t.Errorf("Stats() = %+v, want 2 leased, 1 delayed", s)
+	}
+
+	if err := q.Ack(ctx, first); err != nil {
+		t.Fatalf("Ack() = %v", err)
+	}
+	if err := q.Ack(ctx, first); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("second Ack() = %v, want ErrLeaseLost", err)
+	}
+	if s := stats(t, q); s != (Stats{Leased: 1, Delayed: 1}) {
+		t.Errorf("Stats() after Ack = %+v, want 1 leased, 1 delayed", s)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	q := newQueue(t, WithVisibilityTimeout(20*time.Millisecond))
+	ctx := context.Background()
+	enqueue(t, q, "slow", EnqueueOptions{})
+
+	stale := lease(t, q)
+	time.Sleep(30 * time.Millisecond)
+
+	fresh := lease(t, q)
+	if fresh.ID != stale.ID || fresh.Attempts != 2 {
+		t.Errorf("Lease() after expiry = %+v, want task %d on attempt 2", fresh, stale.ID)
+	}
+	if err := q.Ack(ctx, stale); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Ack() with the expired lease = %v, want ErrLeaseLost", err)
+	}
+	if err := q.Extend(ctx, stale, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Extend() with the expired lease = %v, want ErrLeaseLost", err)
+	}
+	if err := q.Ack(ctx, fresh); err != nil {
+		t.Errorf("Ack() with the new lease = %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	q := newQueue(t, WithRetryDelay(100*time.Millisecond, 300*time.Millisecond))
+
+	for _, tt := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 300 * time.Millisecond}, // Capped
+		{10, 300 * time.Millisecond},
+	} {
+		for i := 0; i < 20; i++ {
+			if d := q.retryDelay(tt.attempt); d < tt.max/2 || d > tt.max {
+				t.Errorf("retryDelay(%d) = %v, want within [%v, %v]", tt.attempt, d, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestNackRetries(t *testing.T) {
+	q := newQueue(t, WithRetryDelay(30*time.Millisecond, time.Second))
+	ctx := context.Background()
+	enqueue(t, q, "flaky", EnqueueOptions{})
+
+	task := lease(t, q)
+	if err := q.Nack(ctx, task, errFlaky); err != nil {
+		t.Fatalf("Nack() = %v", err)
+	}
+	// Hidden for the retry delay
+	if _, err := q.Lease(ctx); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Lease() right after Nack = %v, want ErrEmpty", err)
+	}
+	if s := stats(t, q); s != (Stats{Delayed: 1}) {
+		t.Errorf("Stats() = %+v, want 1 delayed", s)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	retry := lease(t, q)
+	if retry.Attempts != 2 || retry.LastError != errFlaky.Error() {
+		t.Errorf("retry = %+v, want attempt 2 with the last error", retry)
+	}
+}
+
+func TestDeadLettersAndRequeue(t *testing.T) {
+	q := newQueue(t, WithMaxAttempts(2), WithRetryDelay(0, 0))
+	ctx := context.Background()
+	id := enqueue(t, q, "broken", EnqueueOptions{})
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := q.Nack(ctx, lease(t, q), errFlaky); err != nil {
+			t.Fatalf("Nack() on attempt %d = %v", attempt, err)
+		}
+	}
+
+	dead, err := q.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != id || dead[0].Attempts != 2 || dead[0].LastError != errFlaky.Error() {
+		t.Fatalf("DeadLetters() = %+v, want task %d after 2 attempts", dead, id)
+	}
+	if s := stats(t, q); s != (Stats{Dead: 1}) {
+		t.Errorf("Stats() = %+v, want 1 dead", s)
+	}
+
+	if err := q.Requeue(ctx, id); err != nil {
+		t.Fatalf("Requeue() = %v", err)
+	}
+	if task := lease(t, q); task.ID != id || task.Attempts != 1 {
+		t.Errorf("Lease() after Requeue = %+v, want task %d with fresh attempts", task, id)
+	}
+	if err := q.Requeue(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Requeue() of a live task = %v, want ErrNotFound", err)
+	}
+}
+
+func TestBury(t *testing.T) {
+	q := newQueue(t)
+	ctx := context.Background()
+	enqueue(t, q, "invalid", EnqueueOptions{})
+
+	if err := q.Bury(ctx, lease(t, q), errors.New("cannot parse")); err != nil {
+		t.Fatalf("Bury() = %v", err)
+	}
+	if s := stats(t, q); s != (Stats{Dead: 1}) {
+		t.Errorf("Stats() = %+v, want 1 dead after one attempt", s)
+	}
+}
+
+func TestLeaseBuriesExpiredLastAttempt(t *testing.T) {
+	q := newQueue(t, WithVisibilityTimeout(20*time.Millisecond), WithMaxAttempts(1))
+	ctx := context.Background()
+	id := enqueue(t, q, "crashes the worker", EnqueueOptions{})
+
+	lease(t, q) // and never heard of again
+	time.Sleep(30 * time.Millisecond)
+
+	if task, err := q.Lease(ctx); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("Lease() = %+v, %v, want ErrEmpty: the task has no attempts left", task, err)
+	}
+	dead, err := q.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != id || dead[0].LastError != ErrLeaseLost.Error() {
+		t.Errorf("DeadLetters() = %+v, want task %d buried for its expired lease", dead, id)
+	}
+}
+
+// ===== CONSUME =====
+
+func shutdown(t *testing.T, pool *workerpool.WorkerPool[struct{}]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	leakcheck.Check(t)
+	q := newQueue(t, WithRetryDelay(time.Millisecond, time.Millisecond), WithPollInterval(5*time.Millisecond))
+	for _, payload := range []string{"ok", "flaky", "invalid"} {
+		enqueue(t, q, payload, EnqueueOptions{})
+	}
+
+	pool := workerpool.New[struct{}](workerpool.Options{Workers: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.Consume(ctx, pool, func(ctx context.Context, task *Task) error {
+			switch string(task.Payload) {
+			case "flaky":
+				if task.Attempts < 3 {
+					return errFlaky
+				}
+			case "invalid":
+				return workerpool.Permanent(errors.New("invalid payload"))
+			}
+			return nil
+		})
+	}()
+
+	eventually(t, "all tasks to be handled", func() bool { return stats(t, q) == Stats{Dead: 1} })
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Consume() = %v, want context.Canceled", err)
+	}
+	shutdown(t, pool)
+
+	dead, err := q.DeadLetters(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || string(dead[0].Payload) != "invalid" || dead[0].Attempts != 1 {
+		t.Errorf("DeadLetters() = %+v, want only the invalid task, after 1 attempt", dead)
+	}
+}
+
+func TestConsumeBuriesPanics(t *testing.T) {
+	leakcheck.Check(t)
+	q := newQueue(t, WithPollInterval(5*time.Millisecond))
+	enqueue(t, q, "boom", EnqueueOptions{})
+	enqueue(t, q, "fine", EnqueueOptions{})
+
+	pool := workerpool.New[struct{}](workerpool.Options{Workers: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.Consume(ctx, pool, func(ctx context.Context, task *Task) error {
+			if string(task.Payload) == "boom" {
+				panic("boom")
+			}
+			return nil
+		})
+	}()
+
+	// The panicking task is dead-lettered rather than left leased, and the
+	// worker goes on with the next one
+	eventually(t, "both tasks to be handled", func() bool { return stats(t, q) == Stats{Dead: 1} })
+	cancel()
+	<-done
+	shutdown(t, pool)
+
+	dead, err := q.DeadLetters(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || !strings.Contains(dead[0].LastError, "panicked: boom") {
+		t.Errorf("DeadLetters() = %+v, want the panicking task", dead)
+	}
+}
+
+func TestConsumeReleasesQueuedTasks(t *testing.T) {
+	leakcheck.Check(t)
+	q := newQueue(t, WithRetryDelay(time.Hour, time.Hour))
+	for _, payload := range []string{"running", "queued", "waiting"} {
+		enqueue(t, q, payload, EnqueueOptions{})
+	}
+
+	// One worker and one queue slot: "running" runs, "queued" waits in
+	// the pool and "waiting" blocks Submit
+	pool := workerpool.New[struct{}](workerpool.Options{Workers: 1, QueueSize: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	started, finish := make(chan struct{}), make(chan struct{})
+	handlerErr := make(chan error, 1)
+	done := make(chan error)
+	go func() {
+		done <- q.Consume(ctx, pool, func(ctx context.Context, task *Task) error {
+			close(started)
+			<-finish
+			handlerErr <- ctx.Err()
+			return ctx.Err()
+		})
+	}()
+
+	<-started
+	eventually(t, "all tasks to be leased", func() bool { return stats(t, q).Leased == 3 })
+	cancel()
+	<-done
+
+	// Stopping the consumer leaves the running handler to finish, and
+	// Shutdown waits for it
+	close(finish)
+	shutdown(t, pool)
+	if err := <-handlerErr; err != nil {
+		t.Errorf("running handler's ctx.Err() = %v after Consume returned, want nil", err)
+	}
+
+	// The running task was acknowledged; the other two never started and
+	// are visible again right away
+	eventually(t, "queued tasks to be released", func() bool { return stats(t, q) == Stats{Ready: 2} })
+	var released []string
+	for i := 0; i < 2; i++ {
+		task := lease(t, q)
+		if task.Attempts != 1 {
+			t.Errorf("Lease() = %s on attempt %d, want attempt 1", task.Payload, task.Attempts)
+		}
+		released = append(released, string(task.Payload))
+	}
+	slices.Sort(released)
+	if want := []string{"queued", "waiting"}; !slices.Equal(released, want) {
+		t.Errorf("released tasks = %v, want %v", released, want)
+	}
+}
@@ -0,0 +1,165 @@
+// Package userio reads and writes users as CSV and JSON Lines.
+//
+// CSV files start with a header row naming the columns. Import needs name
+// and email and understands age and avatar; other columns such as id are
+// ignored, so an export can be imported again. JSON Lines files hold one
+// user object per line, in the same shape the HTTP API uses.
+package userio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go_lang_tutorial/internal/store"
+)
+
+// Format is a supported file format.
+type Format string
+
+const (
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+)
+
+// FormatOf picks the format from a file extension (.csv, .jsonl, .ndjson).
+func FormatOf(filename string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CSV, nil
+	case ".jsonl", ".ndjson":
+		return JSONL, nil
+	}
+	return "", fmt.Errorf("userio: cannot tell format of %q; use csv or jsonl", filename)
+}
+
+// Read decodes all users from r.
+func Read(r io.Reader, format Format) ([]store.User, error) {
+	switch format {
+	case CSV:
+		return ReadCSV(r)
+	case JSONL:
+		return ReadJSONL(r)
+	}
+	return nil, fmt.Errorf("userio: unknown format %q", format)
+}
+
+// Write encodes users to w.
+func Write(w io.Writer, format Format, users []store.User) error {
+	switch format {
+	case CSV:
+		return WriteCSV(w, users)
+	case JSONL:
+		return WriteJSONL(w, users)
+	}
+	return fmt.Errorf("userio: unknown format %q", format)
+}
+
+// ===== CSV =====
+
+var csvHeader = []string{"id", "name", "email", "age", "avatar"}
+
+func ReadCSV(r io.Reader) ([]store.User, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("userio: read csv header: %w", err)
+	}
+
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "email"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("userio: csv header has no %q column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := col[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var users []store.User
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("userio: %w", err)
+		}
+
+		u := store.User{
+			Name:   field(record, "name"),
+			Email:  field(record, "email"),
+			Avatar: field(record, "avatar"),
+		}
+		if age := field(record, "age"); age != "" {
+			line, _ := cr.FieldPos(0)
+			if u.Age, err = strconv.Atoi(age); err != nil {
+				return nil, fmt.Errorf("userio: line %d: invalid age %q", line, age)
+			}
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func WriteCSV(w io.Writer, users []store.User) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, u := range users {
+		cw.Write([]string{
+			strconv.FormatInt(u.ID, 10),
+			u.Name,
+			u.Email,
+			strconv.Itoa(u.Age),
+			u.Avatar,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ===== JSON LINES =====
+
+func ReadJSONL(r io.Reader) ([]store.User, error) {
+	var users []store.User
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var u store.User
+		if err := json.Unmarshal([]byte(text), &u); err != nil {
+			return nil, fmt.Errorf("userio: line %d: %w", line, err)
+		}
+		u.ID = 0 // IDs are assigned by the database
+		users = append(users, u)
+	}
+	return users, scanner.Err()
+}
+
+func WriteJSONL(w io.Writer, users []store.User) error {
+	enc := json.NewEncoder(w) // Encode ends every value with a newline
+	for _, u := range users {
+		if err := enc.Encode(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
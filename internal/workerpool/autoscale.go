@@ -0,0 +1,151 @@
+package workerpool
+
+import (
+	"fmt"
+	"time"
+)
+
+// ===== AUTOSCALING =====
+// A fixed worker count is either too small for bursts or wasteful when the
+// pool is idle. With Options.Autoscale the pool checks its load every
+// Interval and adds workers while jobs pile up in the queue or wait too
+// long to start, then retires idle workers once the rush is over. The
+// cooldowns keep it from flapping: growing is allowed again soon, but
+// shrinking only after the worker count has been stable for a while.
+//
+// Of a job's latency, only the queue wait is used: more workers shorten
+// the wait but not a slow job itself, so scaling on run time would grow
+// the pool to MaxWorkers without helping. Run times are still reported
+// in Stats.AvgRunMs.
+
+// Autoscale configures a pool whose size follows the load.
+type Autoscale struct {
+	MinWorkers int           // Always running; default 1
+	MaxWorkers int           // Upper bound; default 4×MinWorkers
+	Interval   time.Duration // Time between scaling decisions; default 100ms
+
+	// The pool grows while more than BacklogPerWorker jobs per worker are
+	// queued (default 1), or while jobs waited longer than TargetWait in
+	// the queue before starting, on average since the last decision (zero
+	// ignores wait times). Run time does not count towards TargetWait.
+	BacklogPerWorker int
+	TargetWait       time.Duration
+
+	UpCooldown   time.Duration // Minimum time between changes before growing; default Interval
+	DownCooldown time.Duration // Minimum time between changes before shrinking; default 10×Interval
+
+	// OnScale, if set, is called after every change, e.g. to log it.
+	OnScale func(ScaleEvent)
+}
+
+// ScaleEvent records one scaling decision.
+type ScaleEvent struct {
+	At      time.Time     `json:"at"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Reason  string        `json:"reason"`
+	Queued  int           `json:"queued"`
+	AvgWait time.Duration `json:"avg_wait_ns"`
+}
+
+func (a Autoscale) withDefaults() Autoscale {
+	if a.MinWorkers < 1 {
+		a.MinWorkers = 1
+	}
+	if a.MaxWorkers < a.MinWorkers {
+		a.MaxWorkers = 4 * a.MinWorkers
+	}
+	if a.Interval <= 0 {
+		a.Interval = 100 * time.Millisecond
+	}
+	if a.BacklogPerWorker < 1 {
+		a.BacklogPerWorker = 1
+	}
+	if a.UpCooldown <= 0 {
+		a.UpCooldown = a.Interval
+	}
+	if a.DownCooldown <= 0 {
+		a.DownCooldown = 10 * a.Interval
+	}
+	return a
+}
+
+// autoscale makes a scaling decision every Interval until the pool shuts
+// down
+func (p *WorkerPool[T]) autoscale(a Autoscale) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	lastChange := time.Now()
+	lastWait := p.metrics.wait.snapshot()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		wait := p.metrics.wait.snapshot()
+		avgWait := wait.since(lastWait).avg()
+		lastWait = wait
+
+		workers := int(p.size.Load())
+		idle := workers - int(p.busy.Load())
+		queued := len(p.queue)
+
+		to, reason := workers, ""
+		switch {
+		case workers < a.MaxWorkers && now.Sub(lastChange) >= a.UpCooldown &&
+			queued > workers*a.BacklogPerWorker:
+			// Enough workers to bring the backlog back within bounds
+			need := (queued + a.BacklogPerWorker - 1) / a.BacklogPerWorker
+			to = min(max(need, workers+1), a.MaxWorkers)
+			reason = fmt.Sprintf("backlog of %d jobs for %d workers", queued, workers)
+		case workers < a.MaxWorkers && now.Sub(lastChange) >= a.UpCooldown &&
+			a.TargetWait > 0 && avgWait > a.TargetWait:
+			to = workers + 1
+			reason = fmt.Sprintf("average wait %v above target %v", avgWait.Round(time.Microsecond), a.TargetWait)
+		case workers > a.MinWorkers && now.Sub(lastChange) >= a.DownCooldown &&
+			queued == 0 && idle > 0 && (a.TargetWait == 0 || avgWait <= a.TargetWait/2):
+			to = workers - 1
+			reason = fmt.Sprintf("%d of %d workers idle", idle, workers)
+		}
+		if to == workers || !p.resize(workers, to) {
+			continue
+		}
+
+		lastChange = now
+		event := ScaleEvent{At: now, From: workers, To: to, Reason: reason, Queued: queued, AvgWait: avgWait}
+		p.metrics.mu.Lock()
+		p.metrics.lastScale = &event
+		p.metrics.mu.Unlock()
+		if a.OnScale != nil {
+			a.OnScale(event)
+		}
+	}
+}
+
+// resize adds or retires workers; it reports false if nothing changed
+func (p *WorkerPool[T]) resize(from, to int) bool {
+	if to > from {
+		// No new workers once Shutdown has started closing the queue
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.closed {
+			return false
+		}
+		p.spawn(to - from)
+		p.metrics.scaleUps.Add(1)
+		return true
+	}
+
+	// Only an idle worker, waiting for the next job, takes the request
+	select {
+	case p.quit <- struct{}{}:
+		p.metrics.scaleDowns.Add(1)
+		return true
+	default:
+		return false
+	}
+}
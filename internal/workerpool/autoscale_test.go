@@ -0,0 +1,117 @@
+package workerpool
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/leakcheck"
+)
+
+// eventually polls cond until it holds or a second has passed
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestAutoscaleUpAndDown(t *testing.T) {
+	leakcheck.Check(t)
+
+	var (
+		mu     sync.Mutex
+		events []ScaleEvent
+	)
+	p := New[int](Options{
+		QueueSize: 20,
+		Autoscale: &Autoscale{
+			MinWorkers:   1,
+			MaxWorkers:   4,
+			Interval:     5 * time.Millisecond,
+			DownCooldown: 20 * time.Millisecond,
+			OnScale: func(e ScaleEvent) {
+				mu.Lock()
+				events = append(events, e)
+				mu.Unlock()
+			},
+		},
+	})
+	shutdown(t, p)
+
+	if n := p.Stats().Workers; n != 1 {
+		t.Fatalf("Workers = %d at start, want MinWorkers 1", n)
+	}
+
+	// A backlog of blocked jobs grows the pool, but not past MaxWorkers
+	release := make(chan struct{})
+	var futures []*Future[int]
+	for i := 0; i < 12; i++ {
+		futures = append(futures, submit(t, p, func(context.Context) (int, error) {
+			<-release
+			return 0, nil
+		}))
+	}
+	eventually(t, "4 workers", func() bool { return p.Stats().Workers == 4 })
+	time.Sleep(20 * time.Millisecond)
+	if n := p.Stats().Workers; n != 4 {
+		t.Errorf("Workers = %d under load, want MaxWorkers 4", n)
+	}
+
+	// Once idle it shrinks back, but not below MinWorkers
+	close(release)
+	for _, f := range futures {
+		f.Wait(context.Background())
+	}
+	eventually(t, "1 worker", func() bool { return p.Stats().Workers == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if n := p.Stats().Workers; n != 1 {
+		t.Errorf("Workers = %d when idle, want MinWorkers 1", n)
+	}
+
+	stats := p.Stats()
+	if stats.ScaleUps == 0 || stats.ScaleDowns != 3 {
+		t.Errorf("ScaleUps = %d, ScaleDowns = %d, want some ups and 3 downs", stats.ScaleUps, stats.ScaleDowns)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) == 0 || events[0].From != 1 || events[0].To <= 1 || events[0].Reason == "" {
+		t.Errorf("first ScaleEvent = %+v, want growth from 1 with a reason", events)
+	}
+	if last := events[len(events)-1]; last.To != 1 || *stats.LastScale != last {
+		t.Errorf("last ScaleEvent = %+v, Stats().LastScale = %+v, want both to end at 1 worker", last, stats.LastScale)
+	}
+}
+
+func TestPublishStatsTwice(t *testing.T) {
+	const name = "workerpool_test_pool"
+	read := func() Stats {
+		t.Helper()
+		var s Stats
+		if err := json.Unmarshal([]byte(expvar.Get(name).String()), &s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	first := New[int](Options{Workers: 1})
+	shutdown(t, first)
+	PublishStats(name, first)
+	if n := read().Workers; n != 1 {
+		t.Errorf("Workers = %d, want 1 from the first pool", n)
+	}
+
+	// Publishing under the same name again must not panic, and switches
+	// the variable to the new pool
+	second := New[int](Options{Workers: 3})
+	shutdown(t, second)
+	PublishStats(name, second)
+	if n := read().Workers; n != 3 {
+		t.Errorf("Workers = %d, want 3 from the second pool", n)
+	}
+}
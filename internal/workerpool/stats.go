@@ -0,0 +1,114 @@
+package workerpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go_lang_tutorial/internal/expvarfunc"
+)
+
+// ===== STATISTICS =====
+
+// Stats is a snapshot of a pool's state and counters, in a JSON-friendly
+// form like database.PoolStats.
+type Stats struct {
+	Workers int `json:"workers"`
+	Busy    int `json:"busy"`
+	Queued  int `json:"queued"`
+
+	Submitted uint64 `json:"submitted"`
+	Succeeded uint64 `json:"succeeded"`
+	Failed    uint64 `json:"failed"` // Including cancelled and abandoned jobs
+	Retries   uint64 `json:"retries"`
+
+	// Averages over the pool's lifetime: time from Submit until a worker
+	// picked the job up, and time spent running it including retries
+	AvgWaitMs float64 `json:"avg_wait_ms"`
+	AvgRunMs  float64 `json:"avg_run_ms"`
+
+	ScaleUps   uint64      `json:"scale_ups"`
+	ScaleDowns uint64      `json:"scale_downs"`
+	LastScale  *ScaleEvent `json:"last_scale,omitempty"`
+}
+
+// Stats returns the pool's current statistics.
+func (p *WorkerPool[T]) Stats() Stats {
+	m := &p.metrics
+	return Stats{
+		Workers:    int(p.size.Load()),
+		Busy:       int(p.busy.Load()),
+		Queued:     len(p.queue),
+		Submitted:  m.submitted.Load(),
+		Succeeded:  m.succeeded.Load(),
+		Failed:     m.failed.Load(),
+		Retries:    m.retries.Load(),
+		AvgWaitMs:  ms(m.wait.snapshot().avg()),
+		AvgRunMs:   ms(m.run.snapshot().avg()),
+		ScaleUps:   m.scaleUps.Load(),
+		ScaleDowns: m.scaleDowns.Load(),
+		LastScale:  m.lastScaleEvent(),
+	}
+}
+
+// PublishStats exposes the statistics of p as the expvar variable name,
+// which shows up at /debug/vars on http.DefaultServeMux. Publishing the
+// same name again (e.g. for a pool replacing one that was shut down)
+// switches the variable to the new pool.
+func PublishStats[T any](name string, p *WorkerPool[T]) {
+	expvarfunc.Publish(name, func() any { return p.Stats() })
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type metrics struct {
+	submitted, succeeded, failed, retries atomic.Uint64
+	scaleUps, scaleDowns                  atomic.Uint64
+	wait, run                             latency
+
+	mu        sync.Mutex
+	lastScale *ScaleEvent
+}
+
+func (m *metrics) lastScaleEvent() *ScaleEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastScale == nil {
+		return nil
+	}
+	e := *m.lastScale
+	return &e
+}
+
+// latency accumulates durations; the difference between two snapshots
+// gives the average over that period
+type latency struct {
+	total atomic.Int64 // Nanoseconds
+	count atomic.Int64
+}
+
+type latencySnapshot struct {
+	total, count int64
+}
+
+func (l *latency) observe(d time.Duration) {
+	l.total.Add(int64(d))
+	l.count.Add(1)
+}
+
+func (l *latency) snapshot() latencySnapshot {
+	return latencySnapshot{total: l.total.Load(), count: l.count.Load()}
+}
+
+func (s latencySnapshot) since(prev latencySnapshot) latencySnapshot {
+	return latencySnapshot{total: s.total - prev.total, count: s.count - prev.count}
+}
+
+func (s latencySnapshot) avg() time.Duration {
+	if s.count == 0 {
+		return 0
+	}
+	return time.Duration(s.total / s.count)
+}
@@ -0,0 +1,393 @@
+// Package workerpool runs jobs on a fixed or autoscaled number of
+// goroutines with the error handling a long-running service needs: per-job
+// timeouts, retries with exponential backoff, panic isolation and graceful
+// shutdown.
+//
+//	pool := workerpool.New[string](workerpool.Options{Workers: 4, JobTimeout: time.Second})
+//	f, err := pool.Submit(ctx, func(ctx context.Context) (string, error) {
+//		return fetch(ctx, url)
+//	})
+//	...
+//	body, err := f.Wait(ctx)
+//	...
+//	pool.Shutdown(ctx) // finish queued jobs, or abandon them when ctx ends
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by Submit after Shutdown has been called.
+	ErrClosed = errors.New("workerpool: closed")
+
+	// ErrAbandoned completes the futures of queued jobs that never ran
+	// because Shutdown gave up waiting for them.
+	ErrAbandoned = errors.New("workerpool: job abandoned at shutdown")
+)
+
+// Job is one unit of work. It must return promptly once ctx is done;
+// ctx carries the per-attempt timeout, the submitter's cancellation and
+// the pool's shutdown.
+type Job[T any] func(ctx context.Context) (T, error)
+
+// RetryPolicy controls how failed jobs are retried.
+type RetryPolicy struct {
+	Attempts  int           // Total tries, including the first; 0 or 1 disables retries
+	BaseDelay time.Duration // Delay before the first retry; doubles each time
+	MaxDelay  time.Duration // Upper bound for a single delay; zero means none
+
+	// Retryable decides whether an error is worth another attempt. The
+	// default retries everything except panics, Permanent errors and
+	// cancellation.
+	Retryable func(error) bool
+}
+
+// Options configures a pool. The zero value runs one worker per CPU
+// without timeouts or retries.
+type Options struct {
+	Workers    int           // Goroutines running jobs; default runtime.NumCPU()
+	QueueSize  int           // Jobs waiting for a worker before Submit blocks; default Workers
+	JobTimeout time.Duration // Limit for a single attempt; zero means none
+	Retry      RetryPolicy
+
+	// Autoscale, if set, replaces the fixed Workers count with one that
+	// follows the queue backlog and queue wait times (see autoscale.go)
+	Autoscale *Autoscale
+}
+
+// WorkerPool runs submitted jobs. Create one with New.
+type WorkerPool[T any] struct {
+	opts   Options
+	queue  chan task[T]
+	ctx    context.Context // Cancelled when Shutdown abandons work
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	closed     bool
+	submitting sync.WaitGroup // Submit calls that passed the closed check
+	closeQueue sync.Once
+
+	workers sync.WaitGroup
+	size    atomic.Int32  // Running workers
+	busy    atomic.Int32  // Workers running a job
+	quit    chan struct{} // Receiving from it retires one idle worker
+	done    chan struct{} // Closed when every worker has exited
+
+	metrics metrics
+}
+
+type task[T any] struct {
+	ctx    context.Context
+	job    Job[T]
+	future *Future[T]
+	queued time.Time
+}
+
+// New starts a pool with opts.Workers goroutines, or with
+// opts.Autoscale.MinWorkers when autoscaling.
+func New[T any](opts Options) *WorkerPool[T] {
+	if opts.Autoscale != nil {
+		a := opts.Autoscale.withDefaults()
+		opts.Autoscale = &a
+		opts.Workers = a.MinWorkers
+		if opts.QueueSize < 1 {
+			opts.QueueSize = a.MaxWorkers
+		}
+	}
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = opts.Workers
+	}
+	if opts.Retry.Retryable == nil {
+		opts.Retry.Retryable = defaultRetryable
+	}
+
+	p := &WorkerPool[T]{
+		opts:  opts,
+		queue: make(chan task[T], opts.QueueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	p.spawn(opts.Workers)
+	go func() {
+		p.workers.Wait()
+		close(p.done)
+	}()
+	if opts.Autoscale != nil {
+		go p.autoscale(*opts.Autoscale)
+	}
+
+	return p
+}
+
+// Submit queues job and returns a Future for its result. It blocks while
+// the queue is full, until ctx is done (returning ctx's error) or the pool
+// shuts down (ErrClosed). Cancelling ctx later also cancels the job.
+func (p *WorkerPool[T]) Submit(ctx context.Context, job Job[T]) (*Future[T], error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	p.submitting.Add(1)
+	p.mu.Unlock()
+	defer p.submitting.Done()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	t := task[T]{ctx: ctx, job: job, future: newFuture[T](), queued: time.Now()}
+	select {
+	case p.queue <- t:
+		p.metrics.submitted.Add(1)
+		return t.future, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, ErrClosed
+	}
+}
+
+// Shutdown stops accepting jobs and waits for the queued and running ones
+// to finish. If ctx ends first, running jobs are cancelled, queued ones
+// complete with ErrAbandoned, and Shutdown returns ctx's error without
+// waiting for jobs that ignore cancellation.
+func (p *WorkerPool[T]) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	// Close the queue once no Submit can send to it any more; workers
+	// drain what is left and exit
+	p.closeQueue.Do(func() {
+		go func() {
+			p.submitting.Wait()
+			close(p.queue)
+		}()
+	})
+
+	select {
+	case <-p.done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// ===== WORKERS =====
+
+// spawn starts n more workers
+func (p *WorkerPool[T]) spawn(n int) {
+	p.workers.Add(n)
+	p.size.Add(int32(n))
+	for i := 0; i < n; i++ {
+		go p.worker()
+	}
+}
+
+func (p *WorkerPool[T]) worker() {
+	defer p.workers.Done()
+	defer p.size.Add(-1)
+
+	for {
+		select {
+		case t, ok := <-p.queue:
+			if !ok {
+				return
+			}
+			p.busy.Add(1)
+			p.execute(t)
+			p.busy.Add(-1)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// execute runs t until it succeeds, fails for good or runs out of attempts
+func (p *WorkerPool[T]) execute(t task[T]) {
+	var zero T
+	switch {
+	case p.ctx.Err() != nil:
+		p.finish(t, zero, ErrAbandoned, 0)
+		return
+	case t.ctx.Err() != nil:
+		p.finish(t, zero, t.ctx.Err(), 0)
+		return
+	}
+
+	start := time.Now()
+	p.metrics.wait.observe(start.Sub(t.queued))
+	defer func() { p.metrics.run.observe(time.Since(start)) }()
+
+	// The job is cancelled by its submitter or by an abandoning Shutdown
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	policy := p.opts.Retry
+	delay := policy.BaseDelay
+	for attempt := 1; ; attempt++ {
+		v, err := p.attempt(ctx, t.job)
+		if err == nil || attempt >= policy.Attempts || ctx.Err() != nil || !policy.Retryable(err) {
+			p.finish(t, v, unwrapPermanent(err), attempt)
+			return
+		}
+		p.metrics.retries.Add(1)
+
+		// Sleep somewhere in [delay/2, delay] so that jobs failing together
+		// don't retry in lockstep
+		sleep := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-ctx.Done():
+			p.finish(t, v, errors.Join(err, ctx.Err()), attempt)
+			return
+		case <-time.After(sleep):
+		}
+
+		delay *= 2
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+func (p *WorkerPool[T]) finish(t task[T], v T, err error, attempts int) {
+	if err != nil {
+		p.metrics.failed.Add(1)
+	} else {
+		p.metrics.succeeded.Add(1)
+	}
+	t.future.complete(v, err, attempts)
+}
+
+// attempt runs job once with the per-attempt timeout, turning a panic into
+// a *PanicError so that one bad job cannot take the worker down
+func (p *WorkerPool[T]) attempt(ctx context.Context, job Job[T]) (v T, err error) {
+	if p.opts.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.JobTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return job(ctx)
+}
+
+// ===== ERRORS =====
+
+// PanicError is the error of a job that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("workerpool: job panicked: %v", e.Value)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. invalid input. The
+// future reports err itself.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	return errors.As(err, new(permanentError))
+}
+
+func unwrapPermanent(err error) error {
+	if p, ok := err.(permanentError); ok {
+		return p.err
+	}
+	return err
+}
+
+func defaultRetryable(err error) bool {
+	var panicErr *PanicError
+	switch {
+	case errors.As(err, &panicErr):
+		return false
+	case IsPermanent(err):
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	}
+	return true // Includes attempts that hit JobTimeout
+}
+
+// ===== FUTURES =====
+
+// Future is the pending result of a submitted job.
+type Future[T any] struct {
+	done     chan struct{}
+	value    T
+	err      error
+	attempts int
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+func (f *Future[T]) complete(v T, err error, attempts int) {
+	f.value, f.err, f.attempts = v, err, attempts
+	close(f.done)
+}
+
+// Done is closed once the job has finished.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait returns the job's result once it has finished, or ctx's error if
+// ctx ends first (the job keeps running).
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Attempts reports how often the job ran, once Done is closed. It is 0 for
+// jobs that were cancelled or abandoned before they started.
+func (f *Future[T]) Attempts() int {
+	<-f.done
+	return f.attempts
+}
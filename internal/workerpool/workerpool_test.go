@@ -0,0 +1,269 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go_lang_tutorial/internal/leakcheck"
+)
+
+var errFlaky = errors.New("flaky")
+
+// shutdown shuts p down at the end of the test
+func shutdown[T any](t *testing.T, p *WorkerPool[T]) {
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := p.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown() = %v", err)
+		}
+	})
+}
+
+func submit[T any](t *testing.T, p *WorkerPool[T], job Job[T]) *Future[T] {
+	t.Helper()
+	f, err := p.Submit(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Submit() = %v", err)
+	}
+	return f
+}
+
+func TestFuture(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{Workers: 2})
+	shutdown(t, p)
+
+	f := submit(t, p, func(context.Context) (int, error) { return 42, nil })
+	v, err := f.Wait(context.Background())
+	if v != 42 || err != nil {
+		t.Errorf("Wait() = %d, %v, want 42, nil", v, err)
+	}
+	if n := f.Attempts(); n != 1 {
+		t.Errorf("Attempts() = %d, want 1", n)
+	}
+}
+
+func TestFutureWaitContext(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{Workers: 1})
+	shutdown(t, p)
+
+	release := make(chan struct{})
+	f := submit(t, p, func(context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := f.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The job keeps running after the caller stopped waiting
+	close(release)
+	if v, err := f.Wait(context.Background()); v != 1 || err != nil {
+		t.Errorf("Wait() = %d, %v, want 1, nil", v, err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[string](Options{
+		Workers: 1,
+		Retry:   RetryPolicy{Attempts: 5, BaseDelay: time.Millisecond},
+	})
+	shutdown(t, p)
+
+	var calls atomic.Int32
+	f := submit(t, p, func(context.Context) (string, error) {
+		if calls.Add(1) < 3 {
+			return "", errFlaky
+		}
+		return "ok", nil
+	})
+
+	if v, err := f.Wait(context.Background()); v != "ok" || err != nil {
+		t.Fatalf("Wait() = %q, %v, want ok, nil", v, err)
+	}
+	if n := f.Attempts(); n != 3 {
+		t.Errorf("Attempts() = %d, want 3", n)
+	}
+	if n := p.Stats().Retries; n != 2 {
+		t.Errorf("Stats().Retries = %d, want 2", n)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{
+		Workers: 1,
+		Retry:   RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond},
+	})
+	shutdown(t, p)
+
+	f := submit(t, p, func(context.Context) (int, error) { return 0, errFlaky })
+	if _, err := f.Wait(context.Background()); !errors.Is(err, errFlaky) {
+		t.Errorf("Wait() = %v, want %v", err, errFlaky)
+	}
+	if n := f.Attempts(); n != 3 {
+		t.Errorf("Attempts() = %d, want 3", n)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{
+		Workers:    1,
+		JobTimeout: 10 * time.Millisecond,
+		Retry:      RetryPolicy{Attempts: 2},
+	})
+	shutdown(t, p)
+
+	var calls atomic.Int32
+	f := submit(t, p, func(ctx context.Context) (int, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done() // Only the first attempt hangs
+			return 0, ctx.Err()
+		}
+		return 7, nil
+	})
+
+	if v, err := f.Wait(context.Background()); v != 7 || err != nil {
+		t.Errorf("Wait() = %d, %v, want 7 after a timed-out attempt", v, err)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{
+		Workers: 1,
+		Retry:   RetryPolicy{Attempts: 5, BaseDelay: time.Millisecond},
+	})
+	shutdown(t, p)
+
+	errInvalid := errors.New("invalid input")
+	f := submit(t, p, func(context.Context) (int, error) { return 0, Permanent(errInvalid) })
+
+	_, err := f.Wait(context.Background())
+	if err != errInvalid {
+		t.Errorf("Wait() = %#v, want the error passed to Permanent", err)
+	}
+	if n := f.Attempts(); n != 1 {
+		t.Errorf("Attempts() = %d, want 1", n)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{
+		Workers: 1,
+		Retry:   RetryPolicy{Attempts: 5, BaseDelay: time.Millisecond},
+	})
+	shutdown(t, p)
+
+	f := submit(t, p, func(context.Context) (int, error) { panic("boom") })
+	var panicErr *PanicError
+	if _, err := f.Wait(context.Background()); !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("Wait() = %v, want a *PanicError for boom", err)
+	}
+	if n := f.Attempts(); n != 1 {
+		t.Errorf("Attempts() = %d, want 1: panics are not retried", n)
+	}
+
+	// The only worker survived the panic
+	f = submit(t, p, func(context.Context) (int, error) { return 1, nil })
+	if _, err := f.Wait(context.Background()); err != nil {
+		t.Errorf("job after a panic: %v", err)
+	}
+}
+
+func TestSubmitterCancel(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{Workers: 1})
+	shutdown(t, p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	f, err := p.Submit(ctx, func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+	cancel()
+	if _, err := f.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() = %v, want context.Canceled", err)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{Workers: 2, QueueSize: 10})
+
+	var futures []*Future[int]
+	for i := 0; i < 10; i++ {
+		i := i
+		futures = append(futures, submit(t, p, func(context.Context) (int, error) {
+			time.Sleep(5 * time.Millisecond)
+			return i, nil
+		}))
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	// Every job queued before Shutdown still ran
+	for i, f := range futures {
+		select {
+		case <-f.Done():
+		default:
+			t.Fatalf("job %d not finished after Shutdown", i)
+		}
+		if v, err := f.Wait(context.Background()); v != i || err != nil {
+			t.Errorf("job %d = %d, %v", i, v, err)
+		}
+	}
+
+	if _, err := p.Submit(context.Background(), func(context.Context) (int, error) { return 0, nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit() after Shutdown = %v, want ErrClosed", err)
+	}
+}
+
+func TestShutdownAbandons(t *testing.T) {
+	leakcheck.Check(t)
+	p := New[int](Options{Workers: 1, QueueSize: 5})
+
+	started := make(chan struct{})
+	running := submit(t, p, func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	<-started
+	queued := submit(t, p, func(context.Context) (int, error) { return 1, nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := running.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+		t.Errorf("running job: %v, want context.Canceled", err)
+	}
+	if _, err := queued.Wait(context.Background()); !errors.Is(err, ErrAbandoned) {
+		t.Errorf("queued job: %v, want ErrAbandoned", err)
+	}
+	if n := queued.Attempts(); n != 0 {
+		t.Errorf("queued job Attempts() = %d, want 0", n)
+	}
+}
@@ -0,0 +1,75 @@
+// Package yamlish reads values written in the small subset of YAML used
+// by config files (internal/config) and test fixtures (internal/dbtest):
+//
+//	port: 9090                # plain, with an optional trailing comment
+//	name: "Carol O'Brien"     # double-quoted, with Go/YAML escapes
+//	motto: 'it''s fine'       # single-quoted, '' stands for '
+//
+// A # only starts a comment at the start of a value or after a space, so
+// "a#b" is a plain value. Inside quotes it is never a comment.
+package yamlish
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scalar returns the text of a plain or quoted value, without its comment
+// and surrounding space, and reports whether it was quoted. Callers that
+// convert plain values to numbers or booleans should leave quoted ones as
+// strings.
+func Scalar(s string) (value string, quoted bool, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) && !strings.HasPrefix(s, "'") {
+		return StripComment(s), false, nil
+	}
+
+	end := quotedEnd(s)
+	if end < 0 {
+		return "", false, fmt.Errorf("unterminated string %s", s)
+	}
+	// Only a comment, separated by a space, may follow the closing quote
+	if rest := s[end:]; strings.TrimSpace(rest) != "" && (rest[0] != ' ' || StripComment(rest) != "") {
+		return "", false, fmt.Errorf("unexpected %q after string %s", strings.TrimSpace(rest), s[:end])
+	}
+	if s[0] == '"' {
+		value, err := strconv.Unquote(s[:end])
+		if err != nil {
+			return "", false, fmt.Errorf("invalid string %s: %w", s[:end], err)
+		}
+		return value, true, nil
+	}
+	return strings.ReplaceAll(s[1:end-1], "''", "'"), true, nil
+}
+
+// StripComment removes a trailing " # comment", or a value that is only a
+// comment, from an unquoted value and trims the space around it.
+func StripComment(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "#") {
+		return ""
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// quotedEnd returns the index just past the closing quote of the string
+// that s starts with, or -1 if it is not closed. Double-quoted strings
+// escape with a backslash, single-quoted ones by doubling the quote.
+func quotedEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
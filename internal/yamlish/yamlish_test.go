@@ -0,0 +1,38 @@
+package yamlish
+
+import "testing"
+
+func TestScalar(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		quoted bool
+	}{
+		{"9090", "9090", false},
+		{"  sqlite          # or memory  ", "sqlite", false},
+		{"10  # pool size (forced to 1 for :memory:)", "10", false},
+		{"# only a comment", "", false},
+		{"", "", false},
+		{"a#b", "a#b", false},
+		{":memory:", ":memory:", false},
+		{`"Carol O'Brien"   # quoted for the apostrophe`, "Carol O'Brien", true},
+		{`"a # not a comment"`, "a # not a comment", true},
+		{`"say \"hi\"" # escaped quotes`, `say "hi"`, true},
+		{`'it''s' # doubled quote`, "it's", true},
+		{`''`, "", true},
+	}
+	for _, tt := range tests {
+		got, quoted, err := Scalar(tt.in)
+		if err != nil || got != tt.want || quoted != tt.quoted {
+			t.Errorf("Scalar(%q) = %q, %v, %v, want %q, %v", tt.in, got, quoted, err, tt.want, tt.quoted)
+		}
+	}
+}
+
+func TestScalarErrors(t *testing.T) {
+	for _, in := range []string{`"unterminated`, `'unterminated`, `"a" b`, `'a'#b`, `"\q"`} {
+		if got, _, err := Scalar(in); err == nil {
+			t.Errorf("Scalar(%q) = %q, want an error", in, got)
+		}
+	}
+}